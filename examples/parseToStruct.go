@@ -10,8 +10,13 @@ func main() {
 		User string `data:"USER"`
 	}
 
+	model, err := p.Load("tokens")
+	if err != nil {
+		panic(err)
+	}
+
 	entity := Entity{}
-	if err := p.ParseValueToStruct(input, &entity, "tokens"); err != nil {
+	if err := p.ParseValueToStruct(input, &entity, model); err != nil {
 		panic(err)
 	}
 
@@ -13,13 +13,16 @@ func extractAndSave() {
 		"Hello {USER}, sorry for the delay. Since KSQL aims at being simple it avoids as much as possible to hide the actual SQL that is being generated.\n\nYou should be able to use a query builder to get this behavior you wanted.\n\nThat said I think that keeping this WHERE deleted_at IS NULL clause might actually make the query more readable, since a reader that is not aware of this default value could get very confused.\n\nBut that's just my personal preference.",
 	}
 
-	tk := p.Learn(text)
+	tk, err := p.Learn(text)
+	if err != nil {
+		panic(err)
+	}
 
 	if len(tk) == 0 {
 		panic("error")
 	}
 
-	p.Save(tk, "tokens")
+	p.Save(p.NewModel("tokens", tk), "tokens")
 
 	fmt.Println("Tokens", tk)
 }
@@ -10,6 +10,7 @@ require (
 	github.com/rs/zerolog v1.30.0
 	github.com/shixzie/nlp v0.0.0-20170918143203-39fec05b9991
 	golang.org/x/text v0.13.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -99,7 +100,6 @@ require (
 	google.golang.org/grpc/cmd/protoc-gen-go-grpc v1.3.0 // indirect
 	google.golang.org/protobuf v1.31.0 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
 
 require (
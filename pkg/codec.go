@@ -0,0 +1,231 @@
+package textextractor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Format is the encoding of a model file.
+type Format string
+
+const (
+	FormatGob  Format = "gob"  // versioned binary format, the default
+	FormatJSON Format = "json" // indented JSON with sorted keys
+	FormatYAML Format = "yaml" // the JSON layout written as YAML
+)
+
+// codec encodes a model into the bytes of a model file and back.
+type codec struct {
+	encode func(model *Model) ([]byte, error)
+	decode func(data []byte) (*Model, error)
+}
+
+var codecs = map[Format]codec{
+	FormatGob:  {encode: encodeModel, decode: decodeModel},
+	FormatJSON: {encode: encodeJSON, decode: decodeJSON},
+	FormatYAML: {encode: encodeYAML, decode: decodeYAML},
+}
+
+// formats are picked by the extension of the model file.
+var formats = map[string]Format{
+	".gob":  FormatGob,
+	".json": FormatJSON,
+	".yaml": FormatYAML,
+	".yml":  FormatYAML,
+}
+
+// modelFile returns the file name and format for a model: the format comes from the
+// extension, and names without a known extension are saved as .gob.
+func modelFile(filename string) (string, Format) {
+	if format, ok := formats[strings.ToLower(filepath.Ext(filename))]; ok {
+		return filename, format
+	}
+
+	return filename + ".gob", FormatGob
+}
+
+// encodeJSON writes the model as indented JSON with every object's keys sorted,
+// so the same model always produces the same file and changes diff line by line.
+func encodeJSON(model *Model) ([]byte, error) {
+	tree, err := canonical(model)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(tree, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(data, '\n'), nil
+}
+
+// decodeJSON reads a model written by encodeJSON.
+func decodeJSON(data []byte) (*Model, error) {
+	model := &Model{}
+	if err := json.Unmarshal(data, model); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptModel, err)
+	}
+
+	return checkVersion(model)
+}
+
+// encodeYAML writes the same layout as encodeJSON in YAML.
+func encodeYAML(model *Model) ([]byte, error) {
+	tree, err := canonical(model)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(tree); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// decodeYAML reads a model written by encodeYAML.
+func decodeYAML(data []byte) (*Model, error) {
+	// O YAML é convertido para JSON para usar o mesmo layout
+	var tree interface{}
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptModel, err)
+	}
+
+	data, err := json.Marshal(tree)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptModel, err)
+	}
+
+	return decodeJSON(data)
+}
+
+// canonical converts the model to generic maps, which encoders write with sorted keys.
+func canonical(model *Model) (interface{}, error) {
+	data, err := json.Marshal(model)
+	if err != nil {
+		return nil, err
+	}
+
+	var tree interface{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+
+	return tree, nil
+}
+
+// checkVersion rejects models with a newer schema and stamps older ones as current.
+func checkVersion(model *Model) (*Model, error) {
+	if model.Version > ModelVersion {
+		return nil, fmt.Errorf("%w: schema %d", ErrUnsupportedModel, model.Version)
+	}
+	model.Version = ModelVersion
+
+	return model, nil
+}
+
+// MarshalJSON omits LastSeen for tokens that were never merged into a Model.
+func (t TokenTrain) MarshalJSON() ([]byte, error) {
+	type plain TokenTrain
+	return json.Marshal(struct {
+		plain
+		LastSeen *time.Time `json:"lastSeen,omitempty"`
+	}{plain(t), seen(t.LastSeen)})
+}
+
+// MarshalJSON omits LastSeen for anchors that were never merged into a Model.
+func (a Anchor) MarshalJSON() ([]byte, error) {
+	type plain Anchor
+	return json.Marshal(struct {
+		plain
+		LastSeen *time.Time `json:"lastSeen,omitempty"`
+	}{plain(a), seen(a.LastSeen)})
+}
+
+// MarshalJSON omits LastSeen for tokens that were never merged into the model.
+func (s TokenStats) MarshalJSON() ([]byte, error) {
+	type plain TokenStats
+	return json.Marshal(struct {
+		plain
+		LastSeen *time.Time `json:"lastSeen,omitempty"`
+	}{plain(s), seen(s.LastSeen)})
+}
+
+// seen returns nil for the zero time, so omitempty leaves it out.
+func seen(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+var (
+	contextNames  = []string{CharContext: "char", WordContext: "word"}
+	boundaryNames = []string{NoBoundary: "none", TextBoundary: "text", LineBoundary: "line"}
+)
+
+// MarshalJSON writes the context mode by name.
+func (c ContextMode) MarshalJSON() ([]byte, error) {
+	return marshalName(contextNames, int(c))
+}
+
+// UnmarshalJSON reads a context mode written by name.
+func (c *ContextMode) UnmarshalJSON(data []byte) error {
+	i, err := unmarshalName(contextNames, data)
+	*c = ContextMode(i)
+	return err
+}
+
+// MarshalJSON writes the boundary by name.
+func (b Boundary) MarshalJSON() ([]byte, error) {
+	return marshalName(boundaryNames, int(b))
+}
+
+// UnmarshalJSON reads a boundary written by name.
+func (b *Boundary) UnmarshalJSON(data []byte) error {
+	i, err := unmarshalName(boundaryNames, data)
+	*b = Boundary(i)
+	return err
+}
+
+func marshalName(names []string, i int) ([]byte, error) {
+	if i < 0 || i >= len(names) {
+		return json.Marshal(i)
+	}
+
+	return json.Marshal(names[i])
+}
+
+func unmarshalName(names []string, data []byte) (int, error) {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		// Números também são aceitos
+		var i int
+		if err := json.Unmarshal(data, &i); err != nil {
+			return 0, err
+		}
+		return i, nil
+	}
+
+	for i, n := range names {
+		if n == name {
+			return i, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown value %q", name)
+}
@@ -0,0 +1,249 @@
+package textextractor
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// ContextMode selects how the anchors around a token are measured.
+type ContextMode int
+
+const (
+	// CharContext takes exactly Precision characters on each side of the token.
+	CharContext ContextMode = iota
+	// WordContext takes up to Precision whole words on each side of the token,
+	// stopping at the nearest punctuation.
+	WordContext
+)
+
+// Boundary marks an anchor that was cut short by the edge of the text or of a line.
+type Boundary int
+
+const (
+	// NoBoundary means the anchor is surrounded by more text.
+	NoBoundary Boundary = iota
+	// TextBoundary means the anchor reaches the start (before) or the end (after) of the text.
+	// Learn records the edges of a template as LineBoundary, so this is only set by hand.
+	TextBoundary
+	// LineBoundary means the anchor reaches the start or the end of a line.
+	LineBoundary
+)
+
+var words = regexp.MustCompile(`\S+`)
+
+// beforeAt returns the context that ends at offset in text. When there isn't enough
+// text the shorter context is kept, together with the boundary that cut it. The start of
+// the template is only the start of a line: the value may be on any line of a document.
+func (n TextExtractor) beforeAt(text string, offset int) (string, Boundary) {
+	var anchor string
+	var short bool
+	if n.Context == WordContext {
+		anchor, short = n.wordsBefore(text, offset)
+	} else {
+		regex := regexp.MustCompile(fmt.Sprintf(`(.{0,%v})$`, n.Precision))
+		anchor = regex.FindStringSubmatch(text[:offset])[1]
+		short = utf8.RuneCountInString(anchor) < n.Precision
+	}
+
+	if !short {
+		return anchor, NoBoundary
+	}
+
+	rest := strings.TrimRight(text[:offset-len(anchor)], " \t")
+	if rest == "" || strings.HasSuffix(rest, "\n") {
+		return anchor, LineBoundary
+	}
+
+	return anchor, NoBoundary
+}
+
+// afterAt returns the context that starts at offset in text. When there isn't enough
+// text the shorter context is kept, together with the boundary that cut it. The end of
+// the template is only the end of a line.
+func (n TextExtractor) afterAt(text string, offset int) (string, Boundary) {
+	var anchor string
+	var short bool
+	if n.Context == WordContext {
+		anchor, short = n.wordsAfter(text, offset)
+	} else {
+		regex := regexp.MustCompile(fmt.Sprintf(`^(.{0,%v})`, n.Precision))
+		anchor = regex.FindStringSubmatch(text[offset:])[1]
+		short = utf8.RuneCountInString(anchor) < n.Precision
+	}
+
+	if !short {
+		return anchor, NoBoundary
+	}
+
+	rest := strings.TrimLeft(text[offset+len(anchor):], " \t\r")
+	if rest == "" || strings.HasPrefix(rest, "\n") {
+		return anchor, LineBoundary
+	}
+
+	return anchor, NoBoundary
+}
+
+// anchorBefore returns the context before offset, cut at lo, the end of the previous placeholder.
+func (n TextExtractor) anchorBefore(text string, lo, offset int) (string, Boundary) {
+	anchor, boundary := n.beforeAt(text, offset)
+	if offset-len(anchor) >= lo {
+		return anchor, boundary
+	}
+
+	anchor = text[lo:offset]
+	if i := strings.LastIndexByte(anchor, '\n'); i >= 0 {
+		return anchor[i+1:], LineBoundary
+	}
+
+	return anchor, NoBoundary
+}
+
+// anchorAfter returns the context after offset, cut at hi, the start of the next placeholder.
+func (n TextExtractor) anchorAfter(text string, offset, hi int) (string, Boundary) {
+	anchor, boundary := n.afterAt(text, offset)
+	if offset+len(anchor) <= hi {
+		return anchor, boundary
+	}
+
+	anchor = text[offset:hi]
+	if i := strings.IndexByte(anchor, '\n'); i >= 0 {
+		return anchor[:i], LineBoundary
+	}
+
+	return anchor, NoBoundary
+}
+
+// lineBefore returns the line before offset, or "" when the placeholder ending at lo is on it.
+func lineBefore(text string, lo, offset int) string {
+	line := text[lo:offset]
+	if i := strings.LastIndexByte(line, '\n'); i >= 0 {
+		line = line[i+1:]
+	} else if lo > 0 {
+		return ""
+	}
+
+	return strings.TrimLeft(line, " \t")
+}
+
+// lineAfter returns the line after offset, or "" when the placeholder starting at hi is on it.
+func lineAfter(text string, offset, hi int) string {
+	line := text[offset:hi]
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	} else if hi < len(text) {
+		return ""
+	}
+
+	return strings.TrimRight(line, " \t\r")
+}
+
+// leadGapPattern matches up to n words between a Lead and the WordBefore that follows it.
+// Without a WordBefore the words must end in a space, or they would eat into the value.
+func leadGapPattern(n int, delimited bool) string {
+	if n == 0 {
+		return ""
+	}
+	if delimited {
+		return fmt.Sprintf(`(?:\S+[ \t]*){0,%d}`, n)
+	}
+
+	return fmt.Sprintf(`(?:\S+[ \t]+){0,%d}`, n)
+}
+
+// trailGapPattern matches up to n words between a WordAfter and the Trail after it.
+func trailGapPattern(n int, delimited bool) string {
+	if n == 0 {
+		return ""
+	}
+	if delimited {
+		return fmt.Sprintf(`(?:[ \t]*\S+){0,%d}`, n)
+	}
+
+	return fmt.Sprintf(`(?:[ \t]+\S+){0,%d}`, n)
+}
+
+// wordsBefore returns up to Precision words of the line before offset. A word that
+// ends in punctuation closes the previous clause, so it is only kept when it touches the token.
+// It also reports whether the line ran out of words first.
+func (n TextExtractor) wordsBefore(text string, offset int) (string, bool) {
+	line := text[:offset]
+	if i := strings.LastIndexByte(line, '\n'); i >= 0 {
+		line = line[i+1:]
+	}
+
+	spans := words.FindAllStringIndex(line, -1)
+	start := len(line)
+	count := 0
+	for i := len(spans) - 1; i >= 0 && count < n.Precision; i-- {
+		if count > 0 && endsWithPunctuation(line[spans[i][0]:spans[i][1]]) {
+			return line[start:], false
+		}
+		start = spans[i][0]
+		count++
+	}
+
+	if start == len(line) {
+		return "", true
+	}
+
+	return line[start:], count < n.Precision
+}
+
+// wordsAfter returns up to Precision words of the line after offset, stopping after
+// the first word that ends in punctuation. It also reports whether the line ran out of words first.
+func (n TextExtractor) wordsAfter(text string, offset int) (string, bool) {
+	line := text[offset:]
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+
+	spans := words.FindAllStringIndex(line, -1)
+	end := 0
+	for i := 0; i < len(spans) && i < n.Precision; i++ {
+		end = spans[i][1]
+		if endsWithPunctuation(line[spans[i][0]:end]) {
+			return line[:end], false
+		}
+	}
+
+	return line[:end], len(spans) < n.Precision
+}
+
+// boundaryPrefix returns the regex that anchors a value to the start of the text or of a line.
+func boundaryPrefix(b Boundary) string {
+	switch b {
+	case TextBoundary:
+		return `^\s*`
+	case LineBoundary:
+		return `(?m:^)[ \t]*`
+	}
+
+	return ""
+}
+
+// boundarySuffix returns the regex that anchors a value to the end of the text or of a line.
+func boundarySuffix(b Boundary) string {
+	switch b {
+	case TextBoundary:
+		return `\s*$`
+	case LineBoundary:
+		return `[ \t\r]*(?m:$)`
+	}
+
+	return ""
+}
+
+// anchorPattern returns the regex of an anchor. Word anchors tolerate spacing changes.
+func anchorPattern(anchor string, mode ContextMode) string {
+	if mode == WordContext {
+		return literalPattern(anchor)
+	}
+
+	return regexp.QuoteMeta(anchor)
+}
+
+func endsWithPunctuation(word string) bool {
+	return strings.ContainsAny(word[len(word)-1:], ".,;:!?")
+}
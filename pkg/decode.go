@@ -0,0 +1,556 @@
+package textextractor
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// dateLayouts are tried, in order, for time.Time fields without a layout option.
+var dateLayouts = []string{time.RFC3339, "2006-01-02", "02/01/2006"}
+
+// dataFlags are the tag options that take no value.
+var dataFlags = map[string]bool{"required": true}
+
+// dataTag is a parsed struct tag, e.g. data:"DOB,layout=02/01/2006".
+type dataTag struct {
+	Name    string
+	Options map[string]string
+	Flags   map[string]bool
+}
+
+// parseDataTag reads the data tag of a field. Options are key=value pairs or flags
+// separated by commas; any other part without "=" belongs to the previous value, so
+// layouts such as "Jan 2, 2006" and patterns such as "^[0-9.,]+$" need no escaping.
+func parseDataTag(field reflect.StructField) dataTag {
+	parts := strings.Split(field.Tag.Get("data"), ",")
+	tag := dataTag{Name: strings.TrimSpace(parts[0]), Options: make(map[string]string), Flags: make(map[string]bool)}
+
+	last := ""
+	for _, part := range parts[1:] {
+		if flag := strings.TrimSpace(part); dataFlags[flag] {
+			tag.Flags[flag] = true
+			last = ""
+			continue
+		}
+
+		key, value, found := strings.Cut(part, "=")
+		if !found {
+			if last != "" {
+				tag.Options[last] += "," + part
+			}
+			continue
+		}
+
+		last = strings.TrimSpace(key)
+		tag.Options[last] = value
+	}
+
+	return tag
+}
+
+// nested reports whether a struct field is tagged to be filled as a nested struct.
+func (tag dataTag) nested() bool {
+	_, segment := tag.Options["segment"]
+	return tag.Name != "" || segment
+}
+
+// FieldError is a struct field ParseValueToStruct could not fill.
+type FieldError struct {
+	Field string
+	Token string
+	Value string
+	Err   error
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s (%s) %q: %v", e.Field, e.Token, e.Value, e.Err)
+}
+
+func (e FieldError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeError lists every field ParseValueToStruct could not fill; the other fields are set.
+type DecodeError struct {
+	Fields []FieldError
+}
+
+func (e *DecodeError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		msgs[i] = field.Error()
+	}
+
+	return "parse: " + strings.Join(msgs, "; ")
+}
+
+func (e *DecodeError) Unwrap() []error {
+	errs := make([]error, len(e.Fields))
+	for i, field := range e.Fields {
+		errs[i] = field
+	}
+
+	return errs
+}
+
+var (
+	// ErrRequired means a field tagged required had no value in the document.
+	ErrRequired = errors.New("required value not found")
+	// ErrLowConfidence means a value's precision was below the minconf of its field.
+	ErrLowConfidence = errors.New("value below minimum confidence")
+	// ErrPatternMismatch means a value did not match the regex of its field.
+	ErrPatternMismatch = errors.New("value does not match pattern")
+)
+
+// ValidationError lists the fields of a document that failed the options of their tags.
+// Each field's Err wraps ErrRequired, ErrLowConfidence or ErrPatternMismatch.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		msgs[i] = field.Error()
+	}
+
+	return "validate: " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, len(e.Fields))
+	for i, field := range e.Fields {
+		errs[i] = field
+	}
+
+	return errs
+}
+
+// Missing returns the required fields that had no value.
+func (e *ValidationError) Missing() []FieldError {
+	return e.filter(ErrRequired)
+}
+
+// LowConfidence returns the fields whose value was below their minconf.
+func (e *ValidationError) LowConfidence() []FieldError {
+	return e.filter(ErrLowConfidence)
+}
+
+// Mismatched returns the fields whose value did not match their regex.
+func (e *ValidationError) Mismatched() []FieldError {
+	return e.filter(ErrPatternMismatch)
+}
+
+func (e *ValidationError) filter(target error) []FieldError {
+	var fields []FieldError
+	for _, field := range e.Fields {
+		if errors.Is(field.Err, target) {
+			fields = append(fields, field)
+		}
+	}
+
+	return fields
+}
+
+// validate checks an extracted value against the options of its tag: minconf, compared
+// with Extracted.Precision, and regex. A value that fails is not stored in the field.
+// Precision is not a probability: it is the weighted mean of the value's length and the
+// token name's length, in characters, and it is always 0 unless every weight is set, so a
+// minconf above 0 without weights is reported as a configuration error.
+func validate(extracted Extracted, tag dataTag, weights PrecisionWeights) error {
+	if minconf, ok := tag.Options["minconf"]; ok {
+		min, err := strconv.ParseFloat(strings.TrimSpace(minconf), 64)
+		if err != nil {
+			return fmt.Errorf("invalid minconf %q: %v", minconf, err)
+		}
+		if min > 0 && !weights.scored() {
+			return fmt.Errorf("minconf %s needs PrecisionWeights: without them every precision is 0", minconf)
+		}
+		if extracted.Precision < min {
+			return fmt.Errorf("%w: %g < %g", ErrLowConfidence, extracted.Precision, min)
+		}
+	}
+
+	if pattern, ok := tag.Options["regex"]; ok {
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid regex %q: %v", pattern, err)
+		}
+
+		values := extracted.Values
+		if len(values) == 0 {
+			values = []string{extracted.Value}
+		}
+		for _, value := range values {
+			if !regex.MatchString(value) {
+				return fmt.Errorf("%w %s", ErrPatternMismatch, pattern)
+			}
+		}
+	}
+
+	return nil
+}
+
+// isValidation reports whether err is a failed tag option rather than a conversion error.
+func isValidation(err error) bool {
+	return errors.Is(err, ErrRequired) || errors.Is(err, ErrLowConfidence) || errors.Is(err, ErrPatternMismatch)
+}
+
+// structDecoder fills a struct and the structs nested in it, collecting the fields that
+// fail to convert or to validate.
+type structDecoder struct {
+	model     *Model
+	weights   PrecisionWeights
+	failed    []FieldError
+	invalid   []FieldError
+	extracted int                   // values stored so far
+	visiting  map[reflect.Type]bool // structs being filled, to stop at self-referencing types
+}
+
+// decodeStruct fills the fields of v from input. Field names in errors are prefixed
+// with path, e.g. "Items[1].". Only nested structs tagged with a token or a segment=
+// option are filled, and a struct type already being filled is not entered again.
+func (d *structDecoder) decodeStruct(v reflect.Value, input, path string) {
+	if d.visiting == nil {
+		d.visiting = make(map[reflect.Type]bool)
+	}
+	d.visiting[v.Type()] = true
+	defer delete(d.visiting, v.Type())
+
+	values := d.model.best(input, d.weights)
+
+	for i := 0; i < v.NumField(); i++ {
+		structField := v.Type().Field(i)
+		tag := parseDataTag(structField)
+		field := v.Field(i)
+		if !field.CanSet() {
+			continue
+		}
+		name := path + structField.Name
+
+		switch {
+		case isRecord(field.Type()):
+			if tag.nested() && !d.visiting[recordType(field.Type())] {
+				d.decodeRecord(field, input, name, tag)
+			}
+		case isRecordSlice(field.Type()):
+			if tag.nested() && !d.visiting[recordType(field.Type().Elem())] {
+				d.decodeRecords(field, input, name, tag)
+			}
+		case tag.Name != "":
+			d.decodeField(field, values, name, tag)
+		}
+	}
+}
+
+// decodeRecord fills a nested struct, or a pointer to one, from its section of the input.
+// A nil pointer is only set when something was extracted into the struct.
+func (d *structDecoder) decodeRecord(field reflect.Value, input, name string, tag dataTag) {
+	segments, err := segments(input, tag)
+	if err != nil {
+		d.failed = append(d.failed, FieldError{Field: name, Token: tag.Name, Err: err})
+		return
+	}
+	if len(segments) == 0 {
+		return
+	}
+
+	if field.Kind() != reflect.Pointer {
+		d.decodeStruct(field, segments[0], name+".")
+		return
+	}
+	if !field.IsNil() {
+		d.decodeStruct(field.Elem(), segments[0], name+".")
+		return
+	}
+
+	record := reflect.New(field.Type().Elem())
+	before := d.extracted
+	d.decodeStruct(record.Elem(), segments[0], name+".")
+	if d.extracted > before {
+		field.Set(record)
+	}
+}
+
+// decodeRecords fills a []struct field with one element per segment of the input.
+func (d *structDecoder) decodeRecords(field reflect.Value, input, name string, tag dataTag) {
+	if _, ok := tag.Options["segment"]; !ok {
+		d.failed = append(d.failed, FieldError{Field: name, Token: tag.Name, Err: errors.New("a slice of structs needs a segment= option")})
+		return
+	}
+
+	segments, err := segments(input, tag)
+	if err != nil {
+		d.failed = append(d.failed, FieldError{Field: name, Token: tag.Name, Err: err})
+		return
+	}
+
+	slice := reflect.MakeSlice(field.Type(), len(segments), len(segments))
+	for i, segment := range segments {
+		elem := slice.Index(i)
+		if elem.Kind() == reflect.Pointer {
+			elem.Set(reflect.New(elem.Type().Elem()))
+			elem = elem.Elem()
+		}
+		d.decodeStruct(elem, segment, fmt.Sprintf("%s[%d].", name, i))
+	}
+	field.Set(slice)
+}
+
+// decodeField stores the value of the field's token, checking the options of its tag.
+func (d *structDecoder) decodeField(field reflect.Value, values map[string]Extracted, name string, tag dataTag) {
+	fieldError := FieldError{Field: name, Token: tag.Name}
+
+	extracted, found := values[tag.Name]
+	if found {
+		fieldError.Value = extracted.Value
+		err := validate(extracted, tag, d.weights)
+		if err == nil {
+			err = setField(field, extracted, tag)
+			if err == nil {
+				d.extracted++
+				return
+			}
+		}
+
+		fieldError.Err = err
+		if !isValidation(err) {
+			d.failed = append(d.failed, fieldError)
+			return
+		}
+		d.invalid = append(d.invalid, fieldError)
+	} else if tag.Flags["required"] {
+		fieldError.Err = ErrRequired
+		d.invalid = append(d.invalid, fieldError)
+	}
+
+	// Valores ausentes ou rejeitados usam o default da tag
+	if def, ok := tag.Options["default"]; ok {
+		if err := setField(field, Extracted{Value: def}, tag); err != nil {
+			d.failed = append(d.failed, FieldError{Field: name, Token: tag.Name, Value: def, Err: err})
+		}
+	}
+}
+
+// err returns the conversion and validation errors collected while decoding.
+func (d *structDecoder) err() error {
+	var errs []error
+	if len(d.failed) > 0 {
+		errs = append(errs, &DecodeError{Fields: d.failed})
+	}
+	if len(d.invalid) > 0 {
+		errs = append(errs, &ValidationError{Fields: d.invalid})
+	}
+
+	return errors.Join(errs...)
+}
+
+// segments splits the input at every match of the segment= option of the tag: each
+// segment runs from one match to the next, and text before the first match is left out.
+// Without the option the whole input is the only segment.
+func segments(input string, tag dataTag) ([]string, error) {
+	pattern, ok := tag.Options["segment"]
+	if !ok {
+		return []string{input}, nil
+	}
+
+	regex, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid segment %q: %v", pattern, err)
+	}
+
+	locs := regex.FindAllStringIndex(input, -1)
+	segments := make([]string, len(locs))
+	for i, loc := range locs {
+		end := len(input)
+		if i+1 < len(locs) {
+			end = locs[i+1][0]
+		}
+		segments[i] = input[loc[0]:end]
+	}
+
+	return segments, nil
+}
+
+// isRecord reports whether a field of type t is a nested struct, rather than a value
+// such as time.Time that is converted from text.
+func isRecord(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	return t.Kind() == reflect.Struct && t != timeType && !reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
+
+// recordType returns the struct type of a nested struct field.
+func recordType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Pointer {
+		return t.Elem()
+	}
+
+	return t
+}
+
+// isRecordSlice reports whether a field of type t is a slice of nested structs.
+func isRecordSlice(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice && isRecord(t.Elem())
+}
+
+// setField stores an extracted value in a struct field. Slices, except []byte, receive
+// every occurrence of a repeated token.
+func setField(field reflect.Value, extracted Extracted, tag dataTag) error {
+	if field.Kind() == reflect.Slice && field.Type().Elem().Kind() != reflect.Uint8 {
+		values := extracted.Values
+		if len(values) == 0 {
+			values = []string{extracted.Value}
+		}
+
+		slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setValue(slice.Index(i), value, tag); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+
+		return nil
+	}
+
+	return setValue(field, extracted.Value, tag)
+}
+
+// setValue converts text to the type of v.
+func setValue(v reflect.Value, text string, tag dataTag) error {
+	if v.Kind() == reflect.Pointer {
+		elem := reflect.New(v.Type().Elem())
+		if err := setValue(elem.Elem(), text, tag); err != nil {
+			return err
+		}
+		v.Set(elem)
+
+		return nil
+	}
+
+	switch v.Type() {
+	case timeType:
+		t, err := parseTime(text, tag.Options["layout"])
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+
+		return nil
+	case durationType:
+		d, err := time.ParseDuration(strings.ReplaceAll(text, " ", ""))
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+
+		return nil
+	}
+
+	if reflect.PointerTo(v.Type()).Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(text))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(text)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(text, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(text, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(normalizeNumber(text), v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Complex64, reflect.Complex128:
+		c, err := strconv.ParseComplex(text, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetComplex(c)
+	case reflect.Slice:
+		// []byte recebe o texto como está; outras fatias aqui são aninhadas, como [][]string
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+		v.SetBytes([]byte(text))
+	case reflect.Interface:
+		if v.NumMethod() > 0 {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+		v.Set(reflect.ValueOf(text))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
+
+// parseTime parses text with the layout, or with dateLayouts when there is none.
+func parseTime(text, layout string) (time.Time, error) {
+	if layout != "" {
+		return time.Parse(layout, text)
+	}
+
+	var err error
+	for _, layout := range dateLayouts {
+		t, e := time.Parse(layout, text)
+		if e == nil {
+			return t, nil
+		}
+		err = e
+	}
+
+	return time.Time{}, err
+}
+
+// normalizeNumber turns numbers written like the float and money types, e.g. "2,5",
+// "1.234,56", "1,000 USD" or "R$ 10.00", into the form strconv accepts. The last
+// separator is the decimal one, except for a lone comma followed by three digits.
+func normalizeNumber(text string) string {
+	text = strings.Map(func(r rune) rune {
+		if (r >= '0' && r <= '9') || r == '.' || r == ',' || r == '-' || r == '+' {
+			return r
+		}
+		return -1
+	}, text)
+
+	dot, comma := strings.LastIndex(text, "."), strings.LastIndex(text, ",")
+	if comma > dot && (dot >= 0 || (strings.Count(text, ",") == 1 && len(text)-comma-1 != 3)) {
+		// A vírgula é o separador decimal
+		return strings.Replace(strings.ReplaceAll(text, ".", ""), ",", ".", 1)
+	}
+
+	return strings.ReplaceAll(text, ",", "")
+}
@@ -0,0 +1,228 @@
+package textextractor
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LabeledExample is a real document together with the values it should yield.
+type LabeledExample struct {
+	Text   string
+	Values map[string]string
+}
+
+var (
+	// ErrValueNotFound means a labeled value does not occur in its example text.
+	ErrValueNotFound = errors.New("value not found in text")
+	// ErrValueAmbiguous means a labeled value occurs more than once, or overlaps another value.
+	ErrValueAmbiguous = errors.New("value is ambiguous")
+)
+
+// ExampleIssue is a labeled value that LearnFromExamples could not learn from.
+type ExampleIssue struct {
+	Example int // index of the example
+	Token   string
+	Value   string
+	Err     error // ErrValueNotFound or ErrValueAmbiguous
+}
+
+func (i ExampleIssue) Error() string {
+	return fmt.Sprintf("example %d: %s %q: %v", i.Example, i.Token, i.Value, i.Err)
+}
+
+func (i ExampleIssue) Unwrap() error {
+	return i.Err
+}
+
+// ExampleError lists the values skipped by LearnFromExamples.
+type ExampleError struct {
+	Issues []ExampleIssue
+}
+
+func (e *ExampleError) Error() string {
+	msgs := make([]string, len(e.Issues))
+	for i, issue := range e.Issues {
+		msgs[i] = issue.Error()
+	}
+
+	return "learn: " + strings.Join(msgs, "; ")
+}
+
+func (e *ExampleError) Unwrap() []error {
+	errs := make([]error, len(e.Issues))
+	for i, issue := range e.Issues {
+		errs[i] = issue
+	}
+
+	return errs
+}
+
+// LearnFromExamples learns from documents labeled with their correct values instead of
+// templates. Each value is located in its text and anchored the same way GetBeforeToken and
+// GetAfterToken do. Values that are missing or ambiguous are skipped and reported in an
+// *ExampleError, returned along with the tokens learned from the rest.
+func (n TextExtractor) LearnFromExamples(examples []LabeledExample) ([]TokenTrain, error) {
+	tokens := []TokenTrain{}
+	var issues []ExampleIssue
+
+	for i, example := range examples {
+		tpl, exampleIssues := exampleTemplate(example)
+		for j := range exampleIssues {
+			exampleIssues[j].Example = i
+		}
+		issues = append(issues, exampleIssues...)
+		tokens = append(tokens, n.learnTemplate(tpl)...)
+	}
+
+	if len(issues) > 0 {
+		return tokens, &ExampleError{Issues: issues}
+	}
+
+	return tokens, nil
+}
+
+type valueSpan struct {
+	name       string
+	start, end int
+}
+
+// exampleTemplate turns a labeled example into the template it would have been written as.
+func exampleTemplate(example LabeledExample) (*Template, []ExampleIssue) {
+	names := make([]string, 0, len(example.Values))
+	for name := range example.Values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var issues []ExampleIssue
+	var spans []valueSpan
+	for _, name := range names {
+		value := example.Values[name]
+		start := -1
+		if value != "" {
+			start = strings.Index(example.Text, value)
+		}
+
+		switch {
+		case start < 0:
+			issues = append(issues, ExampleIssue{Token: name, Value: value, Err: ErrValueNotFound})
+		case strings.Contains(example.Text[start+1:], value):
+			issues = append(issues, ExampleIssue{Token: name, Value: value, Err: ErrValueAmbiguous})
+		default:
+			spans = append(spans, valueSpan{name: name, start: start, end: start + len(value)})
+		}
+	}
+
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+
+	// Valores sobrepostos não têm uma posição clara no texto
+	overlaps := make([]bool, len(spans))
+	maxEnd, maxIndex := -1, -1
+	for i, span := range spans {
+		if span.start < maxEnd {
+			overlaps[i], overlaps[maxIndex] = true, true
+		}
+		if span.end > maxEnd {
+			maxEnd, maxIndex = span.end, i
+		}
+	}
+
+	tpl := &Template{}
+	offset := 0
+	for i, span := range spans {
+		if overlaps[i] {
+			issues = append(issues, ExampleIssue{Token: span.name, Value: example.Values[span.name], Err: ErrValueAmbiguous})
+			continue
+		}
+
+		if span.start > offset {
+			tpl.Nodes = append(tpl.Nodes, &Literal{Text: example.Text[offset:span.start]})
+		}
+		tpl.Nodes = append(tpl.Nodes, &Placeholder{Name: span.name, Raw: "{" + span.name + "}"})
+		offset = span.end
+	}
+	if offset < len(example.Text) {
+		tpl.Nodes = append(tpl.Nodes, &Literal{Text: example.Text[offset:]})
+	}
+
+	return tpl, issues
+}
+
+// LearnFromStruct learns from a struct filled by hand and the text it was filled from.
+// It reads the same data tags as ParseValueToStruct, so training and extraction share one
+// schema. Empty fields are ignored; slice fields are learned from their first element and
+// marked as repeated.
+func (n TextExtractor) LearnFromStruct(input string, v interface{}) ([]TokenTrain, error) {
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Pointer && !value.IsNil() {
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("learn: want a struct or a pointer to a struct, got %T", v)
+	}
+
+	example := LabeledExample{Text: input, Values: make(map[string]string)}
+	repeated := make(map[string]bool)
+	for i := 0; i < value.NumField(); i++ {
+		tag := parseDataTag(value.Type().Field(i))
+		name := tag.Name
+		if name == "" {
+			continue
+		}
+
+		field := value.Field(i)
+		if field.Kind() == reflect.Slice {
+			if field.Len() == 0 {
+				continue
+			}
+			field = field.Index(0)
+			repeated[name] = true
+		}
+
+		if text := fieldText(field, tag.Options["layout"]); text != "" {
+			example.Values[name] = text
+		}
+	}
+
+	tokens, err := n.LearnFromExamples([]LabeledExample{example})
+	for i := range tokens {
+		tokens[i].Repeated = repeated[tokens[i].Name]
+	}
+
+	return tokens, err
+}
+
+// fieldText returns the text a field value was read from. Times are formatted with the
+// layout of the field's tag, if any.
+func fieldText(field reflect.Value, layout string) string {
+	for field.Kind() == reflect.Pointer && !field.IsNil() {
+		field = field.Elem()
+	}
+	if !field.IsValid() || !field.CanInterface() || field.IsZero() {
+		return ""
+	}
+
+	if t, ok := field.Interface().(time.Time); ok && layout != "" {
+		return t.Format(layout)
+	}
+
+	switch v := field.Interface().(type) {
+	case string:
+		return v
+	case encoding.TextMarshaler:
+		text, err := v.MarshalText()
+		if err != nil {
+			return ""
+		}
+		return string(text)
+	case fmt.Stringer:
+		return v.String()
+	}
+
+	return fmt.Sprint(field.Interface())
+}
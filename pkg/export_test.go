@@ -0,0 +1,9 @@
+package textextractor
+
+// UnregisterFilter removes a filter registered by a test.
+func UnregisterFilter(name string) {
+	filtersMu.Lock()
+	defer filtersMu.Unlock()
+
+	delete(filters, name)
+}
@@ -0,0 +1,165 @@
+package textextractor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+// FilterFunc transforms an extracted value, e.g. {Name|upper} or {Total|replace:"R$":""}.
+type FilterFunc func(value string, args ...string) (string, error)
+
+// Filter is a filter call saved in the model.
+type Filter struct {
+	Name string   `json:"name"`
+	Args []string `json:"args,omitempty"`
+}
+
+var (
+	// ErrUnknownFilter is returned for a filter that was never registered, e.g. a model
+	// loaded before RegisterFilter was called for its custom filters.
+	ErrUnknownFilter = errors.New("unknown filter")
+	// ErrFilterArgs is returned for a filter called with the wrong number of arguments.
+	ErrFilterArgs = errors.New("wrong number of filter arguments")
+)
+
+// registeredFilter is a filter with the number of arguments it takes; max < 0 means any.
+type registeredFilter struct {
+	fn       FilterFunc
+	min, max int
+}
+
+var (
+	filtersMu sync.RWMutex
+	filters   = map[string]registeredFilter{
+		"trim":     {trimFilter, 0, 1},
+		"upper":    {upperFilter, 0, 0},
+		"lower":    {lowerFilter, 0, 0},
+		"title":    {titleFilter, 0, 0},
+		"digits":   {digitsFilter, 0, 0},
+		"collapse": {collapseFilter, 0, 0},
+		"replace":  {replaceFilter, 2, 2},
+	}
+)
+
+// RegisterFilter makes a filter available to templates under the given name, taking
+// any number of arguments. Registering an existing name replaces it.
+func RegisterFilter(name string, fn FilterFunc) {
+	RegisterFilterArgs(name, fn, 0, -1)
+}
+
+// RegisterFilterArgs registers a filter that takes between min and max arguments, so
+// templates calling it with other counts fail to parse. A negative max means no limit.
+func RegisterFilterArgs(name string, fn FilterFunc, min, max int) {
+	filtersMu.Lock()
+	defer filtersMu.Unlock()
+
+	filters[name] = registeredFilter{fn: fn, min: min, max: max}
+}
+
+func lookupFilter(name string) (registeredFilter, bool) {
+	filtersMu.RLock()
+	defer filtersMu.RUnlock()
+
+	f, ok := filters[name]
+	return f, ok
+}
+
+// checkArgs reports a call with a number of arguments the filter doesn't take.
+func (f registeredFilter) checkArgs(args []string) error {
+	if len(args) >= f.min && (f.max < 0 || len(args) <= f.max) {
+		return nil
+	}
+
+	want := fmt.Sprintf("%d", f.min)
+	switch {
+	case f.max < 0:
+		want = fmt.Sprintf("at least %d", f.min)
+	case f.max != f.min:
+		want = fmt.Sprintf("%d to %d", f.min, f.max)
+	}
+
+	return fmt.Errorf("%w: want %s, got %d", ErrFilterArgs, want, len(args))
+}
+
+// checkFilters reports the first filter of the chain that is not registered or is
+// called with the wrong number of arguments.
+func checkFilters(chain []Filter) error {
+	for _, f := range chain {
+		registered, ok := lookupFilter(f.Name)
+		if !ok {
+			return fmt.Errorf("%w %q", ErrUnknownFilter, f.Name)
+		}
+		if err := registered.checkArgs(f.Args); err != nil {
+			return fmt.Errorf("filter %q: %w", f.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// applyFilters runs the filters over the value in order.
+func applyFilters(value string, chain []Filter) (string, error) {
+	for _, f := range chain {
+		registered, ok := lookupFilter(f.Name)
+		if !ok {
+			return "", fmt.Errorf("%w %q", ErrUnknownFilter, f.Name)
+		}
+
+		var err error
+		value, err = registered.fn(value, f.Args...)
+		if err != nil {
+			return "", fmt.Errorf("filter %q: %w", f.Name, err)
+		}
+	}
+
+	return value, nil
+}
+
+func trimFilter(value string, args ...string) (string, error) {
+	if len(args) > 0 {
+		return strings.Trim(value, args[0]), nil
+	}
+
+	return strings.TrimSpace(value), nil
+}
+
+func upperFilter(value string, _ ...string) (string, error) {
+	return strings.ToUpper(value), nil
+}
+
+func lowerFilter(value string, _ ...string) (string, error) {
+	return strings.ToLower(value), nil
+}
+
+func titleFilter(value string, _ ...string) (string, error) {
+	return cases.Title(language.Und).String(value), nil
+}
+
+// digitsFilter keeps only the digits of the value.
+func digitsFilter(value string, _ ...string) (string, error) {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, value), nil
+}
+
+// collapseFilter turns every run of whitespace into a single space.
+func collapseFilter(value string, _ ...string) (string, error) {
+	return strings.Join(strings.Fields(value), " "), nil
+}
+
+func replaceFilter(value string, args ...string) (string, error) {
+	if len(args) != 2 {
+		return "", fmt.Errorf("want 2 arguments, got %d", len(args))
+	}
+
+	return strings.ReplaceAll(value, args[0], args[1]), nil
+}
@@ -0,0 +1,127 @@
+package textextractor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// FormatVersion is the version of the model file format written by Save.
+const FormatVersion = 1
+
+// modelMagic starts every model file written with a header.
+var modelMagic = [4]byte{'T', 'X', 'E', 'M'}
+
+// headerSize is the size of the header: magic, format version, CRC32 and payload length.
+const headerSize = 4 + 2 + 4 + 8
+
+var (
+	// ErrCorruptModel is returned when a model file is truncated or fails its checksum.
+	ErrCorruptModel = errors.New("corrupt model file")
+	// ErrUnsupportedModel is returned for model files written by a newer version of the package.
+	ErrUnsupportedModel = errors.New("unsupported model file version")
+)
+
+// ModelFileError reports a model file that could not be read.
+type ModelFileError struct {
+	File string
+	Err  error
+}
+
+func (e *ModelFileError) Error() string {
+	return fmt.Sprintf("textextractor: model %s: %v", e.File, e.Err)
+}
+
+func (e *ModelFileError) Unwrap() error {
+	return e.Err
+}
+
+// migrations decode the payload of each format version into a current Model.
+// Version 0 are the headerless gob files written before the header existed.
+var migrations = map[uint16]func(payload []byte) (*Model, error){
+	0: decodeLegacy,
+	1: decodeGob,
+}
+
+// encodeModel writes the header followed by the gob-encoded model.
+func encodeModel(model *Model) ([]byte, error) {
+	var payload bytes.Buffer
+	if err := gob.NewEncoder(&payload).Encode(model); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, headerSize)
+	copy(header, modelMagic[:])
+	binary.BigEndian.PutUint16(header[4:], FormatVersion)
+	binary.BigEndian.PutUint32(header[6:], crc32.ChecksumIEEE(payload.Bytes()))
+	binary.BigEndian.PutUint64(header[10:], uint64(payload.Len()))
+
+	return append(header, payload.Bytes()...), nil
+}
+
+// decodeModel checks the header and upgrades the payload to the current Model.
+func decodeModel(data []byte) (*Model, error) {
+	if !bytes.HasPrefix(data, modelMagic[:]) {
+		return upgrade(0, data)
+	}
+
+	if len(data) < headerSize {
+		return nil, fmt.Errorf("%w: truncated header", ErrCorruptModel)
+	}
+
+	version := binary.BigEndian.Uint16(data[4:])
+	sum := binary.BigEndian.Uint32(data[6:])
+	size := binary.BigEndian.Uint64(data[10:])
+	payload := data[headerSize:]
+
+	if uint64(len(payload)) != size {
+		return nil, fmt.Errorf("%w: payload has %d bytes, header says %d", ErrCorruptModel, len(payload), size)
+	}
+	if crc32.ChecksumIEEE(payload) != sum {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrCorruptModel)
+	}
+
+	return upgrade(version, payload)
+}
+
+// upgrade decodes a payload written with the given format version.
+func upgrade(version uint16, payload []byte) (*Model, error) {
+	migrate, ok := migrations[version]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedModel, version)
+	}
+
+	model, err := migrate(payload)
+	if err != nil {
+		return nil, err
+	}
+	model.Version = ModelVersion
+
+	return model, nil
+}
+
+// decodeGob decodes a gob-encoded Model.
+func decodeGob(payload []byte) (*Model, error) {
+	model := &Model{}
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(model); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptModel, err)
+	}
+
+	return model, nil
+}
+
+// decodeLegacy decodes a headerless file: a bare []TokenTrain, or a Model saved
+// before the header was introduced.
+func decodeLegacy(payload []byte) (*Model, error) {
+	var tokens []TokenTrain
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&tokens); err == nil {
+		model := &Model{Tokens: tokens}
+		model.updateStats()
+		return model, nil
+	}
+
+	return decodeGob(payload)
+}
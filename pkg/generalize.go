@@ -0,0 +1,375 @@
+package textextractor
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Anchor is one context a token was seen with in training, and how many examples support it.
+type Anchor struct {
+	WordBefore     string    `json:"wordBefore"`
+	WordAfter      string    `json:"wordAfter"`
+	BeforeBoundary Boundary  `json:"beforeBoundary,omitempty"`
+	AfterBoundary  Boundary  `json:"afterBoundary,omitempty"`
+	TextBefore     string    `json:"textBefore,omitempty"` // kept while every example of the anchor shares it
+	TextAfter      string    `json:"textAfter,omitempty"`
+	Support        int       `json:"support,omitempty"`
+	LastSeen       time.Time `json:"lastSeen"`
+}
+
+// Generalize aligns every example of the same token and merges them into one token.
+// The examples are aligned on the whole line around the token: its WordBefore and WordAfter
+// are the longest common suffix and prefix of the examples' contexts, its Lead and Trail what
+// the lines start and end with, and the words that differ in between become a gap. So it can
+// match variants never seen in training, and the distinct anchors are kept as Alternatives
+// with their support count.
+func (n TextExtractor) Generalize(tokens []TokenTrain) []TokenTrain {
+	groups := make(map[string][]TokenTrain)
+	var order []string
+	for _, token := range tokens {
+		key := token.generalizeKey()
+		if _, found := groups[key]; !found {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], token)
+	}
+
+	generalized := []TokenTrain{}
+	for _, key := range order {
+		generalized = append(generalized, generalizeGroup(groups[key]))
+	}
+
+	return generalized
+}
+
+func generalizeGroup(group []TokenTrain) TokenTrain {
+	t := group[0]
+	t.Alternatives = nil
+	t.Support = 0
+	t.Negatives = nil
+
+	var contexts []Anchor
+	anchors := make(map[Anchor]*Anchor)
+	var order []Anchor
+	for _, token := range group {
+		t.Support += support(token.Support)
+		if token.LastSeen.After(t.LastSeen) {
+			t.LastSeen = token.LastSeen
+		}
+		if token.Prev != t.Prev {
+			t.Prev = ""
+		}
+		if token.Next != t.Next {
+			t.Next = ""
+		}
+		for _, negative := range token.Negatives {
+			if !containsNegative(t.Negatives, negative) {
+				t.Negatives = append(t.Negatives, negative)
+			}
+		}
+
+		// Tokens already generalized contribute their own alternatives
+		alternatives := token.Alternatives
+		if len(alternatives) == 0 {
+			alternatives = []Anchor{token.anchor()}
+		}
+		for _, alt := range alternatives {
+			key := alt
+			key.Support, key.LastSeen = 0, time.Time{}
+			key.TextBefore, key.TextAfter = "", ""
+			merged, found := anchors[key]
+			if !found {
+				merged = &Anchor{}
+				*merged = alt
+				merged.Support, merged.LastSeen = 0, time.Time{}
+				anchors[key] = merged
+				order = append(order, key)
+			}
+			// A linha inteira só é mantida se todos os exemplos concordarem
+			if merged.TextBefore != alt.TextBefore {
+				merged.TextBefore = ""
+			}
+			if merged.TextAfter != alt.TextAfter {
+				merged.TextAfter = ""
+			}
+			merged.Support += support(alt.Support)
+			if alt.LastSeen.After(merged.LastSeen) {
+				merged.LastSeen = alt.LastSeen
+			}
+			contexts = append(contexts, alt)
+		}
+	}
+
+	if len(order) == 1 {
+		t = t.withAnchor(*anchors[order[0]])
+		return t
+	}
+
+	for _, key := range order {
+		t.Alternatives = append(t.Alternatives, *anchors[key])
+	}
+	sort.SliceStable(t.Alternatives, func(i, j int) bool {
+		return t.Alternatives[i].Support > t.Alternatives[j].Support
+	})
+
+	t.TextBefore, t.TextAfter = "", ""
+	t.Lead, t.LeadGap, t.WordBefore, t.BeforeBoundary = alignBefore(contexts)
+	t.WordAfter, t.Trail, t.TrailGap, t.AfterBoundary = alignAfter(contexts)
+
+	// Sem texto em nenhum lado, o contexto comum casaria com qualquer linha
+	if t.Lead == "" && t.WordBefore == "" && t.WordAfter == "" && t.Trail == "" {
+		t.BeforeBoundary, t.AfterBoundary = NoBoundary, NoBoundary
+	}
+
+	return t
+}
+
+// alignBefore aligns the contexts before a token. When every context reaches the start of
+// its line, the lines are aligned from both ends: what they all start with becomes the lead,
+// what they all end with the anchor, and the words in between a gap of up to that many words.
+// Otherwise, or when the lines start differently, only the common suffix is kept.
+func alignBefore(contexts []Anchor) (lead string, gap int, anchor string, boundary Boundary) {
+	lines := make([]string, len(contexts))
+	for i, c := range contexts {
+		line, ok := c.lineBefore()
+		if !ok {
+			var anchors []string
+			for _, c := range contexts {
+				anchors = append(anchors, c.WordBefore)
+			}
+			return "", 0, meaningful(commonSuffix(anchors)), NoBoundary
+		}
+		lines[i] = line
+	}
+
+	prefix := wordPrefix(lines)
+	rests := make([]string, len(lines))
+	for i, line := range lines {
+		rests[i] = line[len(prefix):]
+	}
+	anchor = meaningful(commonSuffix(rests))
+	for _, rest := range rests {
+		if n := len(strings.Fields(rest[:len(rest)-len(anchor)])); n > gap {
+			gap = n
+		}
+	}
+
+	// Sem um começo comum, só a âncora é mantida
+	lead = meaningful(prefix)
+	if lead == "" {
+		return "", 0, anchor, sharedBoundary(contexts, func(a Anchor) Boundary { return a.BeforeBoundary })
+	}
+	return lead, gap, anchor, lineBoundary(contexts, func(a Anchor) Boundary { return a.BeforeBoundary })
+}
+
+// alignAfter is alignBefore for the contexts after a token.
+func alignAfter(contexts []Anchor) (anchor, trail string, gap int, boundary Boundary) {
+	lines := make([]string, len(contexts))
+	for i, c := range contexts {
+		line, ok := c.lineAfter()
+		if !ok {
+			var anchors []string
+			for _, c := range contexts {
+				anchors = append(anchors, c.WordAfter)
+			}
+			return meaningful(commonPrefix(anchors)), "", 0, NoBoundary
+		}
+		lines[i] = line
+	}
+
+	suffix := wordSuffix(lines)
+	rests := make([]string, len(lines))
+	for i, line := range lines {
+		rests[i] = line[:len(line)-len(suffix)]
+	}
+	anchor = meaningful(commonPrefix(rests))
+	for _, rest := range rests {
+		if n := len(strings.Fields(rest[len(anchor):])); n > gap {
+			gap = n
+		}
+	}
+
+	trail = meaningful(suffix)
+	if trail == "" {
+		return anchor, "", 0, sharedBoundary(contexts, func(a Anchor) Boundary { return a.AfterBoundary })
+	}
+	return anchor, trail, gap, lineBoundary(contexts, func(a Anchor) Boundary { return a.AfterBoundary })
+}
+
+// sharedBoundary returns the boundary every context was cut by, or NoBoundary.
+func sharedBoundary(contexts []Anchor, boundary func(Anchor) Boundary) Boundary {
+	shared := boundary(contexts[0])
+	for _, c := range contexts[1:] {
+		if boundary(c) != shared {
+			return NoBoundary
+		}
+	}
+
+	return shared
+}
+
+// lineBoundary is the boundary of contexts that all reach the edge of their line: the
+// boundary they share, or LineBoundary, which also matches at the edges of the text.
+func lineBoundary(contexts []Anchor, boundary func(Anchor) Boundary) Boundary {
+	if shared := sharedBoundary(contexts, boundary); shared != NoBoundary {
+		return shared
+	}
+
+	return LineBoundary
+}
+
+// lineBefore returns the context from the start of the line to the token, if it is known.
+func (a Anchor) lineBefore() (string, bool) {
+	if a.TextBefore != "" {
+		return a.TextBefore, true
+	}
+
+	return a.WordBefore, a.BeforeBoundary != NoBoundary
+}
+
+// lineAfter returns the context from the token to the end of the line, if it is known.
+func (a Anchor) lineAfter() (string, bool) {
+	if a.TextAfter != "" {
+		return a.TextAfter, true
+	}
+
+	return a.WordAfter, a.AfterBoundary != NoBoundary
+}
+
+// anchor returns the token's own context as an Anchor.
+func (t TokenTrain) anchor() Anchor {
+	return Anchor{
+		WordBefore:     t.WordBefore,
+		WordAfter:      t.WordAfter,
+		BeforeBoundary: t.BeforeBoundary,
+		AfterBoundary:  t.AfterBoundary,
+		TextBefore:     t.TextBefore,
+		TextAfter:      t.TextAfter,
+		Support:        support(t.Support),
+		LastSeen:       t.LastSeen,
+	}
+}
+
+// withAnchor returns a copy of the token that only uses the given context.
+func (t TokenTrain) withAnchor(a Anchor) TokenTrain {
+	t.WordBefore, t.WordAfter = a.WordBefore, a.WordAfter
+	t.BeforeBoundary, t.AfterBoundary = a.BeforeBoundary, a.AfterBoundary
+	t.TextBefore, t.TextAfter = a.TextBefore, a.TextAfter
+	t.Lead, t.LeadGap, t.Trail, t.TrailGap = "", 0, "", 0
+	t.Alternatives = nil
+	return t
+}
+
+// generalizeKey groups tokens that only differ by their anchors.
+func (t TokenTrain) generalizeKey() string {
+	var b strings.Builder
+	b.WriteString(t.Name + "\x00" + t.Type)
+	if t.Optional {
+		b.WriteString("?")
+	}
+	if t.Repeated {
+		b.WriteString("*")
+	}
+	b.WriteByte(byte('0' + t.Context))
+	for _, f := range t.Filters {
+		b.WriteString("|" + f.Name + ":" + strings.Join(f.Args, ":"))
+	}
+
+	return b.String()
+}
+
+// support counts a token learned before support counts existed as one example.
+func support(count int) int {
+	if count == 0 {
+		return 1
+	}
+
+	return count
+}
+
+func containsNegative(negatives []Negative, negative Negative) bool {
+	for _, n := range negatives {
+		if n == negative {
+			return true
+		}
+	}
+
+	return false
+}
+
+func commonPrefix(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	prefix := values[0]
+	for _, v := range values[1:] {
+		for !strings.HasPrefix(v, prefix) {
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+	}
+
+	return prefix
+}
+
+func commonSuffix(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	suffix := values[0]
+	for _, v := range values[1:] {
+		for !strings.HasSuffix(v, suffix) {
+			_, size := utf8.DecodeRuneInString(suffix)
+			suffix = suffix[size:]
+		}
+	}
+
+	return suffix
+}
+
+// wordPrefix is the common prefix of the lines, cut back to whole words: "play to" and
+// "play the" start with "play ", not "play t".
+func wordPrefix(lines []string) string {
+	prefix := commonPrefix(lines)
+	if prefix == "" || strings.ContainsAny(prefix[len(prefix)-1:], " \t") {
+		return prefix
+	}
+	for _, line := range lines {
+		if len(line) > len(prefix) && !strings.ContainsAny(line[len(prefix):len(prefix)+1], " \t") {
+			return prefix[:strings.LastIndexAny(prefix, " \t")+1]
+		}
+	}
+
+	return prefix
+}
+
+// wordSuffix is the common suffix of the lines, cut forward to whole words.
+func wordSuffix(lines []string) string {
+	suffix := commonSuffix(lines)
+	if suffix == "" || strings.ContainsAny(suffix[:1], " \t") {
+		return suffix
+	}
+	for _, line := range lines {
+		cut := len(line) - len(suffix)
+		if cut > 0 && !strings.ContainsAny(line[cut-1:cut], " \t") {
+			if i := strings.IndexAny(suffix, " \t"); i >= 0 {
+				return suffix[i:]
+			}
+			return ""
+		}
+	}
+
+	return suffix
+}
+
+func meaningful(anchor string) string {
+	if strings.TrimSpace(anchor) == "" {
+		return ""
+	}
+
+	return anchor
+}
@@ -0,0 +1,128 @@
+// Package parser parses extraction templates into literal and placeholder nodes.
+//
+// The parser in parser.go is generated from parser.peg; regenerate it with go generate.
+package parser
+
+//go:generate pigeon -o parser.go parser.peg
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Position is a location in a template.
+type Position struct {
+	Line   int
+	Column int
+	Offset int
+}
+
+// Literal is a run of plain text with escapes already resolved.
+type Literal struct {
+	Text string
+	Pos  Position
+}
+
+// Placeholder is a {Name:type?|filter:arg} node.
+type Placeholder struct {
+	Name     string
+	Type     string
+	Optional bool
+	Repeated bool
+	Filters  []*Filter
+	Raw      string
+	Pos      Position
+	TypePos  Position
+}
+
+// Filter is a value transform applied to a placeholder, e.g. |replace:"$":"".
+type Filter struct {
+	Name string
+	Args []string
+	Pos  Position
+}
+
+type typeSpec struct {
+	name string
+	pos  Position
+}
+
+// Error is a syntax error at a position of the template.
+type Error struct {
+	Pos Position
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Pos.Line, e.Pos.Column, e.Msg)
+}
+
+var (
+	errEmpty      = errors.New("empty placeholder")
+	errUnclosed   = errors.New(`unclosed placeholder, use \{ for a literal brace`)
+	errNested     = errors.New("unexpected '{' inside placeholder")
+	errStrayClose = errors.New(`unexpected '}', use \} for a literal brace`)
+)
+
+// ParseTemplate parses a template into a slice of *Literal and *Placeholder nodes.
+func ParseTemplate(template string) ([]interface{}, error) {
+	v, err := Parse("", []byte(template))
+	if err != nil {
+		return nil, firstError(err)
+	}
+
+	return v.([]interface{}), nil
+}
+
+// firstError converts the generated parser's error list into an *Error.
+func firstError(err error) error {
+	list, ok := err.(errList)
+	if !ok || len(list) == 0 {
+		return err
+	}
+
+	pe, ok := list[0].(*parserError)
+	if !ok {
+		return list[0]
+	}
+
+	return &Error{
+		Pos: Position{Line: pe.pos.line, Column: pe.pos.col, Offset: pe.pos.offset},
+		Msg: pe.Inner.Error(),
+	}
+}
+
+func pos(c *current) Position {
+	return Position{Line: c.pos.line, Column: c.pos.col, Offset: c.pos.offset}
+}
+
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case []interface{}:
+		var b strings.Builder
+		for _, s := range v {
+			b.WriteString(toString(s))
+		}
+		return b.String()
+	}
+
+	return fmt.Sprint(v)
+}
+
+func compact(v interface{}) []interface{} {
+	out := []interface{}{}
+	for _, n := range v.([]interface{}) {
+		if n != nil {
+			out = append(out, n)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,1776 @@
+// Code generated by pigeon from parser.peg; DO NOT EDIT.
+
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var g = &grammar{
+	rules: []*rule{
+		{
+			name: "Template",
+			pos:  position{line: 19, col: 1, offset: 180},
+			expr: &actionExpr{
+				pos: position{line: 19, col: 13, offset: 192},
+				run: (*parser).callonTemplate1,
+				expr: &seqExpr{
+					pos: position{line: 19, col: 13, offset: 192},
+					exprs: []interface{}{
+						&labeledExpr{
+							pos:   position{line: 19, col: 13, offset: 192},
+							label: "ns",
+							expr: &zeroOrMoreExpr{
+								pos: position{line: 19, col: 16, offset: 195},
+								expr: &ruleRefExpr{
+									pos:  position{line: 19, col: 16, offset: 195},
+									name: "Node",
+								},
+							},
+						},
+						&ruleRefExpr{
+							pos:  position{line: 19, col: 22, offset: 201},
+							name: "EOF",
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "Node",
+			pos:  position{line: 23, col: 1, offset: 235},
+			expr: &choiceExpr{
+				pos: position{line: 23, col: 9, offset: 243},
+				alternatives: []interface{}{
+					&ruleRefExpr{
+						pos:  position{line: 23, col: 9, offset: 243},
+						name: "Literal",
+					},
+					&ruleRefExpr{
+						pos:  position{line: 23, col: 19, offset: 253},
+						name: "Placeholder",
+					},
+					&ruleRefExpr{
+						pos:  position{line: 23, col: 33, offset: 267},
+						name: "StrayClose",
+					},
+				},
+			},
+		},
+		{
+			name: "Literal",
+			pos:  position{line: 25, col: 1, offset: 279},
+			expr: &actionExpr{
+				pos: position{line: 25, col: 12, offset: 290},
+				run: (*parser).callonLiteral1,
+				expr: &labeledExpr{
+					pos:   position{line: 25, col: 12, offset: 290},
+					label: "chars",
+					expr: &oneOrMoreExpr{
+						pos: position{line: 25, col: 18, offset: 296},
+						expr: &ruleRefExpr{
+							pos:  position{line: 25, col: 18, offset: 296},
+							name: "Char",
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "Char",
+			pos:  position{line: 29, col: 1, offset: 365},
+			expr: &choiceExpr{
+				pos: position{line: 29, col: 9, offset: 373},
+				alternatives: []interface{}{
+					&actionExpr{
+						pos: position{line: 29, col: 9, offset: 373},
+						run: (*parser).callonChar2,
+						expr: &seqExpr{
+							pos: position{line: 29, col: 9, offset: 373},
+							exprs: []interface{}{
+								&litMatcher{
+									pos:        position{line: 29, col: 9, offset: 373},
+									val:        "\\",
+									ignoreCase: false,
+								},
+								&charClassMatcher{
+									pos:        position{line: 29, col: 13, offset: 377},
+									val:        "[{}\\\\]",
+									chars:      []rune{'{', '}', '\\'},
+									ignoreCase: false,
+									inverted:   false,
+								},
+							},
+						},
+					},
+					&actionExpr{
+						pos: position{line: 31, col: 5, offset: 422},
+						run: (*parser).callonChar6,
+						expr: &charClassMatcher{
+							pos:        position{line: 31, col: 5, offset: 422},
+							val:        "[^{}\\\\]",
+							chars:      []rune{'{', '}', '\\'},
+							ignoreCase: false,
+							inverted:   true,
+						},
+					},
+					&actionExpr{
+						pos: position{line: 33, col: 5, offset: 464},
+						run: (*parser).callonChar8,
+						expr: &litMatcher{
+							pos:        position{line: 33, col: 5, offset: 464},
+							val:        "\\",
+							ignoreCase: false,
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "Placeholder",
+			pos:  position{line: 37, col: 1, offset: 501},
+			expr: &choiceExpr{
+				pos: position{line: 37, col: 16, offset: 516},
+				alternatives: []interface{}{
+					&actionExpr{
+						pos: position{line: 37, col: 16, offset: 516},
+						run: (*parser).callonPlaceholder2,
+						expr: &seqExpr{
+							pos: position{line: 37, col: 16, offset: 516},
+							exprs: []interface{}{
+								&litMatcher{
+									pos:        position{line: 37, col: 16, offset: 516},
+									val:        "{",
+									ignoreCase: false,
+								},
+								&ruleRefExpr{
+									pos:  position{line: 37, col: 20, offset: 520},
+									name: "_",
+								},
+								&labeledExpr{
+									pos:   position{line: 37, col: 22, offset: 522},
+									label: "name",
+									expr: &ruleRefExpr{
+										pos:  position{line: 37, col: 27, offset: 527},
+										name: "Name",
+									},
+								},
+								&ruleRefExpr{
+									pos:  position{line: 37, col: 32, offset: 532},
+									name: "_",
+								},
+								&labeledExpr{
+									pos:   position{line: 37, col: 34, offset: 534},
+									label: "typ",
+									expr: &zeroOrOneExpr{
+										pos: position{line: 37, col: 38, offset: 538},
+										expr: &ruleRefExpr{
+											pos:  position{line: 37, col: 38, offset: 538},
+											name: "Type",
+										},
+									},
+								},
+								&ruleRefExpr{
+									pos:  position{line: 37, col: 44, offset: 544},
+									name: "_",
+								},
+								&labeledExpr{
+									pos:   position{line: 37, col: 46, offset: 546},
+									label: "mod",
+									expr: &zeroOrOneExpr{
+										pos: position{line: 37, col: 50, offset: 550},
+										expr: &ruleRefExpr{
+											pos:  position{line: 37, col: 50, offset: 550},
+											name: "Modifier",
+										},
+									},
+								},
+								&ruleRefExpr{
+									pos:  position{line: 37, col: 60, offset: 560},
+									name: "_",
+								},
+								&labeledExpr{
+									pos:   position{line: 37, col: 62, offset: 562},
+									label: "filters",
+									expr: &zeroOrMoreExpr{
+										pos: position{line: 37, col: 70, offset: 570},
+										expr: &ruleRefExpr{
+											pos:  position{line: 37, col: 70, offset: 570},
+											name: "Filter",
+										},
+									},
+								},
+								&litMatcher{
+									pos:        position{line: 37, col: 78, offset: 578},
+									val:        "}",
+									ignoreCase: false,
+								},
+							},
+						},
+					},
+					&actionExpr{
+						pos: position{line: 53, col: 5, offset: 939},
+						run: (*parser).callonPlaceholder21,
+						expr: &seqExpr{
+							pos: position{line: 53, col: 5, offset: 939},
+							exprs: []interface{}{
+								&litMatcher{
+									pos:        position{line: 53, col: 5, offset: 939},
+									val:        "{",
+									ignoreCase: false,
+								},
+								&ruleRefExpr{
+									pos:  position{line: 53, col: 9, offset: 943},
+									name: "_",
+								},
+								&litMatcher{
+									pos:        position{line: 53, col: 11, offset: 945},
+									val:        "}",
+									ignoreCase: false,
+								},
+							},
+						},
+					},
+					&seqExpr{
+						pos: position{line: 55, col: 5, offset: 977},
+						exprs: []interface{}{
+							&litMatcher{
+								pos:        position{line: 55, col: 5, offset: 977},
+								val:        "{",
+								ignoreCase: false,
+							},
+							&zeroOrMoreExpr{
+								pos: position{line: 55, col: 9, offset: 981},
+								expr: &charClassMatcher{
+									pos:        position{line: 55, col: 9, offset: 981},
+									val:        "[^{}]",
+									chars:      []rune{'{', '}'},
+									ignoreCase: false,
+									inverted:   true,
+								},
+							},
+							&ruleRefExpr{
+								pos:  position{line: 55, col: 16, offset: 988},
+								name: "NestedOpen",
+							},
+						},
+					},
+					&actionExpr{
+						pos: position{line: 56, col: 5, offset: 1003},
+						run: (*parser).callonPlaceholder31,
+						expr: &seqExpr{
+							pos: position{line: 56, col: 5, offset: 1003},
+							exprs: []interface{}{
+								&litMatcher{
+									pos:        position{line: 56, col: 5, offset: 1003},
+									val:        "{",
+									ignoreCase: false,
+								},
+								&zeroOrMoreExpr{
+									pos: position{line: 56, col: 9, offset: 1007},
+									expr: &charClassMatcher{
+										pos:        position{line: 56, col: 9, offset: 1007},
+										val:        "[^{}]",
+										chars:      []rune{'{', '}'},
+										ignoreCase: false,
+										inverted:   true,
+									},
+								},
+								&ruleRefExpr{
+									pos:  position{line: 56, col: 16, offset: 1014},
+									name: "EOF",
+								},
+							},
+						},
+					},
+					&actionExpr{
+						pos: position{line: 58, col: 5, offset: 1049},
+						run: (*parser).callonPlaceholder37,
+						expr: &seqExpr{
+							pos: position{line: 58, col: 5, offset: 1049},
+							exprs: []interface{}{
+								&litMatcher{
+									pos:        position{line: 58, col: 5, offset: 1049},
+									val:        "{",
+									ignoreCase: false,
+								},
+								&zeroOrMoreExpr{
+									pos: position{line: 58, col: 9, offset: 1053},
+									expr: &charClassMatcher{
+										pos:        position{line: 58, col: 9, offset: 1053},
+										val:        "[^{}]",
+										chars:      []rune{'{', '}'},
+										ignoreCase: false,
+										inverted:   true,
+									},
+								},
+								&litMatcher{
+									pos:        position{line: 58, col: 16, offset: 1060},
+									val:        "}",
+									ignoreCase: false,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "NestedOpen",
+			pos:  position{line: 62, col: 1, offset: 1127},
+			expr: &actionExpr{
+				pos: position{line: 62, col: 15, offset: 1141},
+				run: (*parser).callonNestedOpen1,
+				expr: &andExpr{
+					pos: position{line: 62, col: 15, offset: 1141},
+					expr: &litMatcher{
+						pos:        position{line: 62, col: 16, offset: 1142},
+						val:        "{",
+						ignoreCase: false,
+					},
+				},
+			},
+		},
+		{
+			name: "Type",
+			pos:  position{line: 66, col: 1, offset: 1174},
+			expr: &actionExpr{
+				pos: position{line: 66, col: 9, offset: 1182},
+				run: (*parser).callonType1,
+				expr: &seqExpr{
+					pos: position{line: 66, col: 9, offset: 1182},
+					exprs: []interface{}{
+						&litMatcher{
+							pos:        position{line: 66, col: 9, offset: 1182},
+							val:        ":",
+							ignoreCase: false,
+						},
+						&ruleRefExpr{
+							pos:  position{line: 66, col: 13, offset: 1186},
+							name: "_",
+						},
+						&labeledExpr{
+							pos:   position{line: 66, col: 15, offset: 1188},
+							label: "typ",
+							expr: &ruleRefExpr{
+								pos:  position{line: 66, col: 19, offset: 1192},
+								name: "TypeName",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "TypeName",
+			pos:  position{line: 70, col: 1, offset: 1223},
+			expr: &actionExpr{
+				pos: position{line: 70, col: 13, offset: 1235},
+				run: (*parser).callonTypeName1,
+				expr: &ruleRefExpr{
+					pos:  position{line: 70, col: 13, offset: 1235},
+					name: "Name",
+				},
+			},
+		},
+		{
+			name: "Filter",
+			pos:  position{line: 74, col: 1, offset: 1303},
+			expr: &actionExpr{
+				pos: position{line: 74, col: 11, offset: 1313},
+				run: (*parser).callonFilter1,
+				expr: &seqExpr{
+					pos: position{line: 74, col: 11, offset: 1313},
+					exprs: []interface{}{
+						&litMatcher{
+							pos:        position{line: 74, col: 11, offset: 1313},
+							val:        "|",
+							ignoreCase: false,
+						},
+						&ruleRefExpr{
+							pos:  position{line: 74, col: 15, offset: 1317},
+							name: "_",
+						},
+						&labeledExpr{
+							pos:   position{line: 74, col: 17, offset: 1319},
+							label: "name",
+							expr: &ruleRefExpr{
+								pos:  position{line: 74, col: 22, offset: 1324},
+								name: "FilterName",
+							},
+						},
+						&labeledExpr{
+							pos:   position{line: 74, col: 33, offset: 1335},
+							label: "args",
+							expr: &zeroOrMoreExpr{
+								pos: position{line: 74, col: 38, offset: 1340},
+								expr: &ruleRefExpr{
+									pos:  position{line: 74, col: 38, offset: 1340},
+									name: "FilterArg",
+								},
+							},
+						},
+						&ruleRefExpr{
+							pos:  position{line: 74, col: 49, offset: 1351},
+							name: "_",
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "FilterName",
+			pos:  position{line: 82, col: 1, offset: 1477},
+			expr: &actionExpr{
+				pos: position{line: 82, col: 15, offset: 1491},
+				run: (*parser).callonFilterName1,
+				expr: &seqExpr{
+					pos: position{line: 82, col: 15, offset: 1491},
+					exprs: []interface{}{
+						&charClassMatcher{
+							pos:        position{line: 82, col: 15, offset: 1491},
+							val:        "[A-Za-z_]",
+							chars:      []rune{'_'},
+							ranges:     []rune{'A', 'Z', 'a', 'z'},
+							ignoreCase: false,
+							inverted:   false,
+						},
+						&zeroOrMoreExpr{
+							pos: position{line: 82, col: 25, offset: 1501},
+							expr: &charClassMatcher{
+								pos:        position{line: 82, col: 25, offset: 1501},
+								val:        "[A-Za-z0-9_-]",
+								chars:      []rune{'_', '-'},
+								ranges:     []rune{'A', 'Z', 'a', 'z', '0', '9'},
+								ignoreCase: false,
+								inverted:   false,
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "FilterArg",
+			pos:  position{line: 86, col: 1, offset: 1577},
+			expr: &actionExpr{
+				pos: position{line: 86, col: 14, offset: 1590},
+				run: (*parser).callonFilterArg1,
+				expr: &seqExpr{
+					pos: position{line: 86, col: 14, offset: 1590},
+					exprs: []interface{}{
+						&litMatcher{
+							pos:        position{line: 86, col: 14, offset: 1590},
+							val:        ":",
+							ignoreCase: false,
+						},
+						&labeledExpr{
+							pos:   position{line: 86, col: 18, offset: 1594},
+							label: "arg",
+							expr: &choiceExpr{
+								pos: position{line: 86, col: 23, offset: 1599},
+								alternatives: []interface{}{
+									&ruleRefExpr{
+										pos:  position{line: 86, col: 23, offset: 1599},
+										name: "Quoted",
+									},
+									&ruleRefExpr{
+										pos:  position{line: 86, col: 32, offset: 1608},
+										name: "Bare",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "Quoted",
+			pos:  position{line: 90, col: 1, offset: 1636},
+			expr: &actionExpr{
+				pos: position{line: 90, col: 11, offset: 1646},
+				run: (*parser).callonQuoted1,
+				expr: &seqExpr{
+					pos: position{line: 90, col: 11, offset: 1646},
+					exprs: []interface{}{
+						&litMatcher{
+							pos:        position{line: 90, col: 11, offset: 1646},
+							val:        "\"",
+							ignoreCase: false,
+						},
+						&labeledExpr{
+							pos:   position{line: 90, col: 15, offset: 1650},
+							label: "chars",
+							expr: &zeroOrMoreExpr{
+								pos: position{line: 90, col: 21, offset: 1656},
+								expr: &ruleRefExpr{
+									pos:  position{line: 90, col: 21, offset: 1656},
+									name: "QuotedChar",
+								},
+							},
+						},
+						&litMatcher{
+							pos:        position{line: 90, col: 33, offset: 1668},
+							val:        "\"",
+							ignoreCase: false,
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "QuotedChar",
+			pos:  position{line: 94, col: 1, offset: 1706},
+			expr: &choiceExpr{
+				pos: position{line: 94, col: 15, offset: 1720},
+				alternatives: []interface{}{
+					&actionExpr{
+						pos: position{line: 94, col: 15, offset: 1720},
+						run: (*parser).callonQuotedChar2,
+						expr: &seqExpr{
+							pos: position{line: 94, col: 15, offset: 1720},
+							exprs: []interface{}{
+								&litMatcher{
+									pos:        position{line: 94, col: 15, offset: 1720},
+									val:        "\\",
+									ignoreCase: false,
+								},
+								&labeledExpr{
+									pos:   position{line: 94, col: 19, offset: 1724},
+									label: "ch",
+									expr: &anyMatcher{
+										line: 94, col: 22, offset: 1727,
+									},
+								},
+							},
+						},
+					},
+					&actionExpr{
+						pos: position{line: 96, col: 5, offset: 1767},
+						run: (*parser).callonQuotedChar7,
+						expr: &charClassMatcher{
+							pos:        position{line: 96, col: 5, offset: 1767},
+							val:        "[^\"\\\\]",
+							chars:      []rune{'"', '\\'},
+							ignoreCase: false,
+							inverted:   true,
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "Bare",
+			pos:  position{line: 100, col: 1, offset: 1807},
+			expr: &actionExpr{
+				pos: position{line: 100, col: 9, offset: 1815},
+				run: (*parser).callonBare1,
+				expr: &zeroOrMoreExpr{
+					pos: position{line: 100, col: 9, offset: 1815},
+					expr: &charClassMatcher{
+						pos:        position{line: 100, col: 9, offset: 1815},
+						val:        "[^:|\"{}]",
+						chars:      []rune{':', '|', '"', '{', '}'},
+						ignoreCase: false,
+						inverted:   true,
+					},
+				},
+			},
+		},
+		{
+			name: "Modifier",
+			pos:  position{line: 104, col: 1, offset: 1858},
+			expr: &actionExpr{
+				pos: position{line: 104, col: 13, offset: 1870},
+				run: (*parser).callonModifier1,
+				expr: &charClassMatcher{
+					pos:        position{line: 104, col: 13, offset: 1870},
+					val:        "[?*]",
+					chars:      []rune{'?', '*'},
+					ignoreCase: false,
+					inverted:   false,
+				},
+			},
+		},
+		{
+			name: "Name",
+			pos:  position{line: 108, col: 1, offset: 1908},
+			expr: &actionExpr{
+				pos: position{line: 108, col: 9, offset: 1916},
+				run: (*parser).callonName1,
+				expr: &seqExpr{
+					pos: position{line: 108, col: 9, offset: 1916},
+					exprs: []interface{}{
+						&charClassMatcher{
+							pos:        position{line: 108, col: 9, offset: 1916},
+							val:        "[A-Za-z_]",
+							chars:      []rune{'_'},
+							ranges:     []rune{'A', 'Z', 'a', 'z'},
+							ignoreCase: false,
+							inverted:   false,
+						},
+						&zeroOrMoreExpr{
+							pos: position{line: 108, col: 19, offset: 1926},
+							expr: &charClassMatcher{
+								pos:        position{line: 108, col: 19, offset: 1926},
+								val:        "[A-Za-z0-9_]",
+								chars:      []rune{'_'},
+								ranges:     []rune{'A', 'Z', 'a', 'z', '0', '9'},
+								ignoreCase: false,
+								inverted:   false,
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "StrayClose",
+			pos:  position{line: 112, col: 1, offset: 1973},
+			expr: &actionExpr{
+				pos: position{line: 112, col: 15, offset: 1987},
+				run: (*parser).callonStrayClose1,
+				expr: &litMatcher{
+					pos:        position{line: 112, col: 15, offset: 1987},
+					val:        "}",
+					ignoreCase: false,
+				},
+			},
+		},
+		{
+			name: "_",
+			pos:  position{line: 116, col: 1, offset: 2023},
+			expr: &zeroOrMoreExpr{
+				pos: position{line: 116, col: 6, offset: 2028},
+				expr: &charClassMatcher{
+					pos:        position{line: 116, col: 6, offset: 2028},
+					val:        "[ \\t]",
+					chars:      []rune{' ', '\t'},
+					ignoreCase: false,
+					inverted:   false,
+				},
+			},
+		},
+		{
+			name: "EOF",
+			pos:  position{line: 118, col: 1, offset: 2036},
+			expr: &notExpr{
+				pos: position{line: 118, col: 8, offset: 2043},
+				expr: &anyMatcher{
+					line: 118, col: 9, offset: 2044,
+				},
+			},
+		},
+	},
+}
+
+func (c *current) onTemplate1(ns interface{}) (interface{}, error) {
+	return compact(ns), nil
+}
+
+func (p *parser) callonTemplate1() (interface{}, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onTemplate1(stack["ns"])
+}
+
+func (c *current) onLiteral1(chars interface{}) (interface{}, error) {
+	return &Literal{Text: toString(chars), Pos: pos(c)}, nil
+}
+
+func (p *parser) callonLiteral1() (interface{}, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onLiteral1(stack["chars"])
+}
+
+func (c *current) onChar2() (interface{}, error) {
+	return string(c.text[1:]), nil
+}
+
+func (p *parser) callonChar2() (interface{}, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onChar2()
+}
+
+func (c *current) onChar6() (interface{}, error) {
+	return string(c.text), nil
+}
+
+func (p *parser) callonChar6() (interface{}, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onChar6()
+}
+
+func (c *current) onChar8() (interface{}, error) {
+	return string(c.text), nil
+}
+
+func (p *parser) callonChar8() (interface{}, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onChar8()
+}
+
+func (c *current) onPlaceholder2(name, typ, mod, filters interface{}) (interface{}, error) {
+	p := &Placeholder{Name: toString(name), Raw: string(c.text), Pos: pos(c)}
+	if typ != nil {
+		t := typ.(*typeSpec)
+		p.Type, p.TypePos = t.name, t.pos
+	}
+	switch toString(mod) {
+	case "?":
+		p.Optional = true
+	case "*":
+		p.Repeated = true
+	}
+	for _, f := range filters.([]interface{}) {
+		p.Filters = append(p.Filters, f.(*Filter))
+	}
+	return p, nil
+}
+
+func (p *parser) callonPlaceholder2() (interface{}, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onPlaceholder2(stack["name"], stack["typ"], stack["mod"], stack["filters"])
+}
+
+func (c *current) onPlaceholder21() (interface{}, error) {
+	return nil, errEmpty
+}
+
+func (p *parser) callonPlaceholder21() (interface{}, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onPlaceholder21()
+}
+
+func (c *current) onPlaceholder31() (interface{}, error) {
+	return nil, errUnclosed
+}
+
+func (p *parser) callonPlaceholder31() (interface{}, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onPlaceholder31()
+}
+
+func (c *current) onPlaceholder37() (interface{}, error) {
+	return nil, fmt.Errorf("invalid placeholder %q", c.text)
+}
+
+func (p *parser) callonPlaceholder37() (interface{}, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onPlaceholder37()
+}
+
+func (c *current) onNestedOpen1() (interface{}, error) {
+	return nil, errNested
+}
+
+func (p *parser) callonNestedOpen1() (interface{}, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onNestedOpen1()
+}
+
+func (c *current) onType1(typ interface{}) (interface{}, error) {
+	return typ, nil
+}
+
+func (p *parser) callonType1() (interface{}, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onType1(stack["typ"])
+}
+
+func (c *current) onTypeName1() (interface{}, error) {
+	return &typeSpec{name: string(c.text), pos: pos(c)}, nil
+}
+
+func (p *parser) callonTypeName1() (interface{}, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onTypeName1()
+}
+
+func (c *current) onFilter1(name, args interface{}) (interface{}, error) {
+	f := name.(*Filter)
+	for _, a := range args.([]interface{}) {
+		f.Args = append(f.Args, a.(string))
+	}
+	return f, nil
+}
+
+func (p *parser) callonFilter1() (interface{}, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onFilter1(stack["name"], stack["args"])
+}
+
+func (c *current) onFilterName1() (interface{}, error) {
+	return &Filter{Name: string(c.text), Pos: pos(c)}, nil
+}
+
+func (p *parser) callonFilterName1() (interface{}, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onFilterName1()
+}
+
+func (c *current) onFilterArg1(arg interface{}) (interface{}, error) {
+	return arg, nil
+}
+
+func (p *parser) callonFilterArg1() (interface{}, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onFilterArg1(stack["arg"])
+}
+
+func (c *current) onQuoted1(chars interface{}) (interface{}, error) {
+	return toString(chars), nil
+}
+
+func (p *parser) callonQuoted1() (interface{}, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onQuoted1(stack["chars"])
+}
+
+func (c *current) onQuotedChar2(ch interface{}) (interface{}, error) {
+	return string(c.text[1:]), nil
+}
+
+func (p *parser) callonQuotedChar2() (interface{}, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onQuotedChar2(stack["ch"])
+}
+
+func (c *current) onQuotedChar7() (interface{}, error) {
+	return string(c.text), nil
+}
+
+func (p *parser) callonQuotedChar7() (interface{}, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onQuotedChar7()
+}
+
+func (c *current) onBare1() (interface{}, error) {
+	return string(c.text), nil
+}
+
+func (p *parser) callonBare1() (interface{}, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onBare1()
+}
+
+func (c *current) onModifier1() (interface{}, error) {
+	return string(c.text), nil
+}
+
+func (p *parser) callonModifier1() (interface{}, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onModifier1()
+}
+
+func (c *current) onName1() (interface{}, error) {
+	return string(c.text), nil
+}
+
+func (p *parser) callonName1() (interface{}, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onName1()
+}
+
+func (c *current) onStrayClose1() (interface{}, error) {
+	return nil, errStrayClose
+}
+
+func (p *parser) callonStrayClose1() (interface{}, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onStrayClose1()
+}
+
+var (
+	// errNoRule is returned when the grammar to parse has no rule.
+	errNoRule = errors.New("grammar has no rule")
+
+	// errInvalidEncoding is returned when the source is not properly
+	// utf8-encoded.
+	errInvalidEncoding = errors.New("invalid encoding")
+
+	// errNoMatch is returned if no match could be found.
+	errNoMatch = errors.New("no match found")
+)
+
+// Option is a function that can set an option on the parser. It returns
+// the previous setting as an Option.
+type Option func(*parser) Option
+
+// Debug creates an Option to set the debug flag to b. When set to true,
+// debugging information is printed to stdout while parsing.
+//
+// The default is false.
+func Debug(b bool) Option {
+	return func(p *parser) Option {
+		old := p.debug
+		p.debug = b
+		return Debug(old)
+	}
+}
+
+// Memoize creates an Option to set the memoize flag to b. When set to true,
+// the parser will cache all results so each expression is evaluated only
+// once. This guarantees linear parsing time even for pathological cases,
+// at the expense of more memory and slower times for typical cases.
+//
+// The default is false.
+func Memoize(b bool) Option {
+	return func(p *parser) Option {
+		old := p.memoize
+		p.memoize = b
+		return Memoize(old)
+	}
+}
+
+// Recover creates an Option to set the recover flag to b. When set to
+// true, this causes the parser to recover from panics and convert it
+// to an error. Setting it to false can be useful while debugging to
+// access the full stack trace.
+//
+// The default is true.
+func Recover(b bool) Option {
+	return func(p *parser) Option {
+		old := p.recover
+		p.recover = b
+		return Recover(old)
+	}
+}
+
+// ParseFile parses the file identified by filename.
+func ParseFile(filename string, opts ...Option) (interface{}, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseReader(filename, f, opts...)
+}
+
+// ParseReader parses the data from r using filename as information in the
+// error messages.
+func ParseReader(filename string, r io.Reader, opts ...Option) (interface{}, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(filename, b, opts...)
+}
+
+// Parse parses the data from b using filename as information in the
+// error messages.
+func Parse(filename string, b []byte, opts ...Option) (interface{}, error) {
+	return newParser(filename, b, opts...).parse(g)
+}
+
+// position records a position in the text.
+type position struct {
+	line, col, offset int
+}
+
+func (p position) String() string {
+	return fmt.Sprintf("%d:%d [%d]", p.line, p.col, p.offset)
+}
+
+// savepoint stores all state required to go back to this point in the
+// parser.
+type savepoint struct {
+	position
+	rn rune
+	w  int
+}
+
+type current struct {
+	pos  position // start position of the match
+	text []byte   // raw text of the match
+}
+
+// the AST types...
+
+type grammar struct {
+	pos   position
+	rules []*rule
+}
+
+type rule struct {
+	pos         position
+	name        string
+	displayName string
+	expr        interface{}
+}
+
+type choiceExpr struct {
+	pos          position
+	alternatives []interface{}
+}
+
+type actionExpr struct {
+	pos  position
+	expr interface{}
+	run  func(*parser) (interface{}, error)
+}
+
+type seqExpr struct {
+	pos   position
+	exprs []interface{}
+}
+
+type labeledExpr struct {
+	pos   position
+	label string
+	expr  interface{}
+}
+
+type expr struct {
+	pos  position
+	expr interface{}
+}
+
+type andExpr expr
+type notExpr expr
+type zeroOrOneExpr expr
+type zeroOrMoreExpr expr
+type oneOrMoreExpr expr
+
+type ruleRefExpr struct {
+	pos  position
+	name string
+}
+
+type andCodeExpr struct {
+	pos position
+	run func(*parser) (bool, error)
+}
+
+type notCodeExpr struct {
+	pos position
+	run func(*parser) (bool, error)
+}
+
+type litMatcher struct {
+	pos        position
+	val        string
+	ignoreCase bool
+}
+
+type charClassMatcher struct {
+	pos        position
+	val        string
+	chars      []rune
+	ranges     []rune
+	classes    []*unicode.RangeTable
+	ignoreCase bool
+	inverted   bool
+}
+
+type anyMatcher position
+
+// errList cumulates the errors found by the parser.
+type errList []error
+
+func (e *errList) add(err error) {
+	*e = append(*e, err)
+}
+
+func (e errList) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	e.dedupe()
+	return e
+}
+
+func (e *errList) dedupe() {
+	var cleaned []error
+	set := make(map[string]bool)
+	for _, err := range *e {
+		if msg := err.Error(); !set[msg] {
+			set[msg] = true
+			cleaned = append(cleaned, err)
+		}
+	}
+	*e = cleaned
+}
+
+func (e errList) Error() string {
+	switch len(e) {
+	case 0:
+		return ""
+	case 1:
+		return e[0].Error()
+	default:
+		var buf bytes.Buffer
+
+		for i, err := range e {
+			if i > 0 {
+				buf.WriteRune('\n')
+			}
+			buf.WriteString(err.Error())
+		}
+		return buf.String()
+	}
+}
+
+// parserError wraps an error with a prefix indicating the rule in which
+// the error occurred. The original error is stored in the Inner field.
+type parserError struct {
+	Inner  error
+	pos    position
+	prefix string
+}
+
+// Error returns the error message.
+func (p *parserError) Error() string {
+	return p.prefix + ": " + p.Inner.Error()
+}
+
+// newParser creates a parser with the specified input source and options.
+func newParser(filename string, b []byte, opts ...Option) *parser {
+	p := &parser{
+		filename: filename,
+		errs:     new(errList),
+		data:     b,
+		pt:       savepoint{position: position{line: 1}},
+		recover:  true,
+	}
+	p.setOptions(opts)
+	return p
+}
+
+// setOptions applies the options to the parser.
+func (p *parser) setOptions(opts []Option) {
+	for _, opt := range opts {
+		opt(p)
+	}
+}
+
+type resultTuple struct {
+	v   interface{}
+	b   bool
+	end savepoint
+}
+
+type parser struct {
+	filename string
+	pt       savepoint
+	cur      current
+
+	data []byte
+	errs *errList
+
+	recover bool
+	debug   bool
+	depth   int
+
+	memoize bool
+	// memoization table for the packrat algorithm:
+	// map[offset in source] map[expression or rule] {value, match}
+	memo map[int]map[interface{}]resultTuple
+
+	// rules table, maps the rule identifier to the rule node
+	rules map[string]*rule
+	// variables stack, map of label to value
+	vstack []map[string]interface{}
+	// rule stack, allows identification of the current rule in errors
+	rstack []*rule
+
+	// stats
+	exprCnt int
+}
+
+// push a variable set on the vstack.
+func (p *parser) pushV() {
+	if cap(p.vstack) == len(p.vstack) {
+		// create new empty slot in the stack
+		p.vstack = append(p.vstack, nil)
+	} else {
+		// slice to 1 more
+		p.vstack = p.vstack[:len(p.vstack)+1]
+	}
+
+	// get the last args set
+	m := p.vstack[len(p.vstack)-1]
+	if m != nil && len(m) == 0 {
+		// empty map, all good
+		return
+	}
+
+	m = make(map[string]interface{})
+	p.vstack[len(p.vstack)-1] = m
+}
+
+// pop a variable set from the vstack.
+func (p *parser) popV() {
+	// if the map is not empty, clear it
+	m := p.vstack[len(p.vstack)-1]
+	if len(m) > 0 {
+		// GC that map
+		p.vstack[len(p.vstack)-1] = nil
+	}
+	p.vstack = p.vstack[:len(p.vstack)-1]
+}
+
+func (p *parser) print(prefix, s string) string {
+	if !p.debug {
+		return s
+	}
+
+	fmt.Printf("%s %d:%d:%d: %s [%#U]\n",
+		prefix, p.pt.line, p.pt.col, p.pt.offset, s, p.pt.rn)
+	return s
+}
+
+func (p *parser) in(s string) string {
+	p.depth++
+	return p.print(strings.Repeat(" ", p.depth)+">", s)
+}
+
+func (p *parser) out(s string) string {
+	p.depth--
+	return p.print(strings.Repeat(" ", p.depth)+"<", s)
+}
+
+func (p *parser) addErr(err error) {
+	p.addErrAt(err, p.pt.position)
+}
+
+func (p *parser) addErrAt(err error, pos position) {
+	var buf bytes.Buffer
+	if p.filename != "" {
+		buf.WriteString(p.filename)
+	}
+	if buf.Len() > 0 {
+		buf.WriteString(":")
+	}
+	buf.WriteString(fmt.Sprintf("%d:%d (%d)", pos.line, pos.col, pos.offset))
+	if len(p.rstack) > 0 {
+		if buf.Len() > 0 {
+			buf.WriteString(": ")
+		}
+		rule := p.rstack[len(p.rstack)-1]
+		if rule.displayName != "" {
+			buf.WriteString("rule " + rule.displayName)
+		} else {
+			buf.WriteString("rule " + rule.name)
+		}
+	}
+	pe := &parserError{Inner: err, pos: pos, prefix: buf.String()}
+	p.errs.add(pe)
+}
+
+// read advances the parser to the next rune.
+func (p *parser) read() {
+	p.pt.offset += p.pt.w
+	rn, n := utf8.DecodeRune(p.data[p.pt.offset:])
+	p.pt.rn = rn
+	p.pt.w = n
+	p.pt.col++
+	if rn == '\n' {
+		p.pt.line++
+		p.pt.col = 0
+	}
+
+	if rn == utf8.RuneError {
+		if n == 1 {
+			p.addErr(errInvalidEncoding)
+		}
+	}
+}
+
+// restore parser position to the savepoint pt.
+func (p *parser) restore(pt savepoint) {
+	if p.debug {
+		defer p.out(p.in("restore"))
+	}
+	if pt.offset == p.pt.offset {
+		return
+	}
+	p.pt = pt
+}
+
+// get the slice of bytes from the savepoint start to the current position.
+func (p *parser) sliceFrom(start savepoint) []byte {
+	return p.data[start.position.offset:p.pt.position.offset]
+}
+
+func (p *parser) getMemoized(node interface{}) (resultTuple, bool) {
+	if len(p.memo) == 0 {
+		return resultTuple{}, false
+	}
+	m := p.memo[p.pt.offset]
+	if len(m) == 0 {
+		return resultTuple{}, false
+	}
+	res, ok := m[node]
+	return res, ok
+}
+
+func (p *parser) setMemoized(pt savepoint, node interface{}, tuple resultTuple) {
+	if p.memo == nil {
+		p.memo = make(map[int]map[interface{}]resultTuple)
+	}
+	m := p.memo[pt.offset]
+	if m == nil {
+		m = make(map[interface{}]resultTuple)
+		p.memo[pt.offset] = m
+	}
+	m[node] = tuple
+}
+
+func (p *parser) buildRulesTable(g *grammar) {
+	p.rules = make(map[string]*rule, len(g.rules))
+	for _, r := range g.rules {
+		p.rules[r.name] = r
+	}
+}
+
+func (p *parser) parse(g *grammar) (val interface{}, err error) {
+	if len(g.rules) == 0 {
+		p.addErr(errNoRule)
+		return nil, p.errs.err()
+	}
+
+	// TODO : not super critical but this could be generated
+	p.buildRulesTable(g)
+
+	if p.recover {
+		// panic can be used in action code to stop parsing immediately
+		// and return the panic as an error.
+		defer func() {
+			if e := recover(); e != nil {
+				if p.debug {
+					defer p.out(p.in("panic handler"))
+				}
+				val = nil
+				switch e := e.(type) {
+				case error:
+					p.addErr(e)
+				default:
+					p.addErr(fmt.Errorf("%v", e))
+				}
+				err = p.errs.err()
+			}
+		}()
+	}
+
+	// start rule is rule [0]
+	p.read() // advance to first rune
+	val, ok := p.parseRule(g.rules[0])
+	if !ok {
+		if len(*p.errs) == 0 {
+			// make sure this doesn't go out silently
+			p.addErr(errNoMatch)
+		}
+		return nil, p.errs.err()
+	}
+	return val, p.errs.err()
+}
+
+func (p *parser) parseRule(rule *rule) (interface{}, bool) {
+	if p.debug {
+		defer p.out(p.in("parseRule " + rule.name))
+	}
+
+	if p.memoize {
+		res, ok := p.getMemoized(rule)
+		if ok {
+			p.restore(res.end)
+			return res.v, res.b
+		}
+	}
+
+	start := p.pt
+	p.rstack = append(p.rstack, rule)
+	p.pushV()
+	val, ok := p.parseExpr(rule.expr)
+	p.popV()
+	p.rstack = p.rstack[:len(p.rstack)-1]
+	if ok && p.debug {
+		p.print(strings.Repeat(" ", p.depth)+"MATCH", string(p.sliceFrom(start)))
+	}
+
+	if p.memoize {
+		p.setMemoized(start, rule, resultTuple{val, ok, p.pt})
+	}
+	return val, ok
+}
+
+func (p *parser) parseExpr(expr interface{}) (interface{}, bool) {
+	var pt savepoint
+	var ok bool
+
+	if p.memoize {
+		res, ok := p.getMemoized(expr)
+		if ok {
+			p.restore(res.end)
+			return res.v, res.b
+		}
+		pt = p.pt
+	}
+
+	p.exprCnt++
+	var val interface{}
+	switch expr := expr.(type) {
+	case *actionExpr:
+		val, ok = p.parseActionExpr(expr)
+	case *andCodeExpr:
+		val, ok = p.parseAndCodeExpr(expr)
+	case *andExpr:
+		val, ok = p.parseAndExpr(expr)
+	case *anyMatcher:
+		val, ok = p.parseAnyMatcher(expr)
+	case *charClassMatcher:
+		val, ok = p.parseCharClassMatcher(expr)
+	case *choiceExpr:
+		val, ok = p.parseChoiceExpr(expr)
+	case *labeledExpr:
+		val, ok = p.parseLabeledExpr(expr)
+	case *litMatcher:
+		val, ok = p.parseLitMatcher(expr)
+	case *notCodeExpr:
+		val, ok = p.parseNotCodeExpr(expr)
+	case *notExpr:
+		val, ok = p.parseNotExpr(expr)
+	case *oneOrMoreExpr:
+		val, ok = p.parseOneOrMoreExpr(expr)
+	case *ruleRefExpr:
+		val, ok = p.parseRuleRefExpr(expr)
+	case *seqExpr:
+		val, ok = p.parseSeqExpr(expr)
+	case *zeroOrMoreExpr:
+		val, ok = p.parseZeroOrMoreExpr(expr)
+	case *zeroOrOneExpr:
+		val, ok = p.parseZeroOrOneExpr(expr)
+	default:
+		panic(fmt.Sprintf("unknown expression type %T", expr))
+	}
+	if p.memoize {
+		p.setMemoized(pt, expr, resultTuple{val, ok, p.pt})
+	}
+	return val, ok
+}
+
+func (p *parser) parseActionExpr(act *actionExpr) (interface{}, bool) {
+	if p.debug {
+		defer p.out(p.in("parseActionExpr"))
+	}
+
+	start := p.pt
+	val, ok := p.parseExpr(act.expr)
+	if ok {
+		p.cur.pos = start.position
+		p.cur.text = p.sliceFrom(start)
+		actVal, err := act.run(p)
+		if err != nil {
+			p.addErrAt(err, start.position)
+		}
+		val = actVal
+	}
+	if ok && p.debug {
+		p.print(strings.Repeat(" ", p.depth)+"MATCH", string(p.sliceFrom(start)))
+	}
+	return val, ok
+}
+
+func (p *parser) parseAndCodeExpr(and *andCodeExpr) (interface{}, bool) {
+	if p.debug {
+		defer p.out(p.in("parseAndCodeExpr"))
+	}
+
+	ok, err := and.run(p)
+	if err != nil {
+		p.addErr(err)
+	}
+	return nil, ok
+}
+
+func (p *parser) parseAndExpr(and *andExpr) (interface{}, bool) {
+	if p.debug {
+		defer p.out(p.in("parseAndExpr"))
+	}
+
+	pt := p.pt
+	p.pushV()
+	_, ok := p.parseExpr(and.expr)
+	p.popV()
+	p.restore(pt)
+	return nil, ok
+}
+
+func (p *parser) parseAnyMatcher(any *anyMatcher) (interface{}, bool) {
+	if p.debug {
+		defer p.out(p.in("parseAnyMatcher"))
+	}
+
+	if p.pt.rn != utf8.RuneError {
+		start := p.pt
+		p.read()
+		return p.sliceFrom(start), true
+	}
+	return nil, false
+}
+
+func (p *parser) parseCharClassMatcher(chr *charClassMatcher) (interface{}, bool) {
+	if p.debug {
+		defer p.out(p.in("parseCharClassMatcher"))
+	}
+
+	cur := p.pt.rn
+	// can't match EOF
+	if cur == utf8.RuneError {
+		return nil, false
+	}
+	start := p.pt
+	if chr.ignoreCase {
+		cur = unicode.ToLower(cur)
+	}
+
+	// try to match in the list of available chars
+	for _, rn := range chr.chars {
+		if rn == cur {
+			if chr.inverted {
+				return nil, false
+			}
+			p.read()
+			return p.sliceFrom(start), true
+		}
+	}
+
+	// try to match in the list of ranges
+	for i := 0; i < len(chr.ranges); i += 2 {
+		if cur >= chr.ranges[i] && cur <= chr.ranges[i+1] {
+			if chr.inverted {
+				return nil, false
+			}
+			p.read()
+			return p.sliceFrom(start), true
+		}
+	}
+
+	// try to match in the list of Unicode classes
+	for _, cl := range chr.classes {
+		if unicode.Is(cl, cur) {
+			if chr.inverted {
+				return nil, false
+			}
+			p.read()
+			return p.sliceFrom(start), true
+		}
+	}
+
+	if chr.inverted {
+		p.read()
+		return p.sliceFrom(start), true
+	}
+	return nil, false
+}
+
+func (p *parser) parseChoiceExpr(ch *choiceExpr) (interface{}, bool) {
+	if p.debug {
+		defer p.out(p.in("parseChoiceExpr"))
+	}
+
+	for _, alt := range ch.alternatives {
+		p.pushV()
+		val, ok := p.parseExpr(alt)
+		p.popV()
+		if ok {
+			return val, ok
+		}
+	}
+	return nil, false
+}
+
+func (p *parser) parseLabeledExpr(lab *labeledExpr) (interface{}, bool) {
+	if p.debug {
+		defer p.out(p.in("parseLabeledExpr"))
+	}
+
+	p.pushV()
+	val, ok := p.parseExpr(lab.expr)
+	p.popV()
+	if ok && lab.label != "" {
+		m := p.vstack[len(p.vstack)-1]
+		m[lab.label] = val
+	}
+	return val, ok
+}
+
+func (p *parser) parseLitMatcher(lit *litMatcher) (interface{}, bool) {
+	if p.debug {
+		defer p.out(p.in("parseLitMatcher"))
+	}
+
+	start := p.pt
+	for _, want := range lit.val {
+		cur := p.pt.rn
+		if lit.ignoreCase {
+			cur = unicode.ToLower(cur)
+		}
+		if cur != want {
+			p.restore(start)
+			return nil, false
+		}
+		p.read()
+	}
+	return p.sliceFrom(start), true
+}
+
+func (p *parser) parseNotCodeExpr(not *notCodeExpr) (interface{}, bool) {
+	if p.debug {
+		defer p.out(p.in("parseNotCodeExpr"))
+	}
+
+	ok, err := not.run(p)
+	if err != nil {
+		p.addErr(err)
+	}
+	return nil, !ok
+}
+
+func (p *parser) parseNotExpr(not *notExpr) (interface{}, bool) {
+	if p.debug {
+		defer p.out(p.in("parseNotExpr"))
+	}
+
+	pt := p.pt
+	p.pushV()
+	_, ok := p.parseExpr(not.expr)
+	p.popV()
+	p.restore(pt)
+	return nil, !ok
+}
+
+func (p *parser) parseOneOrMoreExpr(expr *oneOrMoreExpr) (interface{}, bool) {
+	if p.debug {
+		defer p.out(p.in("parseOneOrMoreExpr"))
+	}
+
+	var vals []interface{}
+
+	for {
+		p.pushV()
+		val, ok := p.parseExpr(expr.expr)
+		p.popV()
+		if !ok {
+			if len(vals) == 0 {
+				// did not match once, no match
+				return nil, false
+			}
+			return vals, true
+		}
+		vals = append(vals, val)
+	}
+}
+
+func (p *parser) parseRuleRefExpr(ref *ruleRefExpr) (interface{}, bool) {
+	if p.debug {
+		defer p.out(p.in("parseRuleRefExpr " + ref.name))
+	}
+
+	if ref.name == "" {
+		panic(fmt.Sprintf("%s: invalid rule: missing name", ref.pos))
+	}
+
+	rule := p.rules[ref.name]
+	if rule == nil {
+		p.addErr(fmt.Errorf("undefined rule: %s", ref.name))
+		return nil, false
+	}
+	return p.parseRule(rule)
+}
+
+func (p *parser) parseSeqExpr(seq *seqExpr) (interface{}, bool) {
+	if p.debug {
+		defer p.out(p.in("parseSeqExpr"))
+	}
+
+	var vals []interface{}
+
+	pt := p.pt
+	for _, expr := range seq.exprs {
+		val, ok := p.parseExpr(expr)
+		if !ok {
+			p.restore(pt)
+			return nil, false
+		}
+		vals = append(vals, val)
+	}
+	return vals, true
+}
+
+func (p *parser) parseZeroOrMoreExpr(expr *zeroOrMoreExpr) (interface{}, bool) {
+	if p.debug {
+		defer p.out(p.in("parseZeroOrMoreExpr"))
+	}
+
+	var vals []interface{}
+
+	for {
+		p.pushV()
+		val, ok := p.parseExpr(expr.expr)
+		p.popV()
+		if !ok {
+			return vals, true
+		}
+		vals = append(vals, val)
+	}
+}
+
+func (p *parser) parseZeroOrOneExpr(expr *zeroOrOneExpr) (interface{}, bool) {
+	if p.debug {
+		defer p.out(p.in("parseZeroOrOneExpr"))
+	}
+
+	p.pushV()
+	val, _ := p.parseExpr(expr.expr)
+	p.popV()
+	// whether it matched or not, consider it a match
+	return val, true
+}
+
+func rangeTable(class string) *unicode.RangeTable {
+	if rt, ok := unicode.Categories[class]; ok {
+		return rt
+	}
+	if rt, ok := unicode.Properties[class]; ok {
+		return rt
+	}
+	if rt, ok := unicode.Scripts[class]; ok {
+		return rt
+	}
+
+	// cannot happen
+	panic(fmt.Sprintf("invalid Unicode class: %s", class))
+}
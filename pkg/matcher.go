@@ -0,0 +1,134 @@
+package textextractor
+
+import (
+	"regexp"
+	"strings"
+)
+
+// tokenMatcher is a token with its regular expressions compiled once, so a model can
+// extract from many documents without rebuilding them on every call.
+type tokenMatcher struct {
+	token        TokenTrain
+	regex        *regexp.Regexp // nil when the token has no usable anchors
+	alternatives []*tokenMatcher
+}
+
+// compileToken compiles the token and each of its alternative contexts.
+func compileToken(token TokenTrain) *tokenMatcher {
+	m := &tokenMatcher{token: token}
+	for _, alt := range token.Alternatives {
+		m.alternatives = append(m.alternatives, compileToken(token.withAnchor(alt)))
+	}
+
+	// Verifica se os campos WordBefore e WordAfter são válidos
+	if !token.hasBefore() && !token.hasAfter() {
+		return m
+	}
+
+	if regex, ok := token.regex(); ok {
+		m.regex = regex
+	}
+
+	return m
+}
+
+// extract finds the token's value in the input. The contexts seen in training are tried
+// first; the common context, whose gaps may take words of the value, only when none matches.
+func (m *tokenMatcher) extract(input string, weights PrecisionWeights) (Extracted, bool) {
+	// As alternativas competem pela precisão; no empate vence o contexto mais
+	// longo, e depois a alternativa com mais exemplos
+	var best Extracted
+	var context int
+	var found bool
+	for _, alt := range m.alternatives {
+		extracted, altContext, have := alt.find(input, weights)
+		if !have {
+			continue
+		}
+		if !found || extracted.Precision > best.Precision ||
+			(extracted.Precision == best.Precision && altContext > context) {
+			best, context, found = extracted, altContext, true
+		}
+	}
+	if found {
+		return best, true
+	}
+
+	best, _, found = m.find(input, weights)
+	return best, found
+}
+
+// find matches the token's own context, without its alternatives. It also returns how
+// much of the first match the anchors took.
+func (m *tokenMatcher) find(input string, weights PrecisionWeights) (Extracted, int, bool) {
+	if m.regex == nil {
+		return Extracted{}, 0, false
+	}
+
+	// Encontrando a correspondência; tokens repetidos usam todas as ocorrências
+	model := m.token
+	extracted := Extracted{Token: model.Name}
+	var context int
+	for _, loc := range m.regex.FindAllStringSubmatchIndex(input, -1) {
+		if loc[2] < 0 || loc[2] == loc[3] {
+			continue
+		}
+
+		// Restrições negativas descartam correspondências conhecidas como erradas
+		if model.rejects(input, loc[0], strings.TrimSpace(input[loc[2]:loc[3]])) {
+			continue
+		}
+
+		// Uma lista de valores tipados vira um valor por item
+		for _, raw := range splitList(model.Type, model.Repeated, input[loc[2]:loc[3]]) {
+			result, ok := finishValue(model, raw)
+			if !ok {
+				continue
+			}
+
+			if len(extracted.Values) == 0 {
+				// Calculando a precisão
+				extracted.Value = result
+				extracted.Precision = calculatePrecision(result, len(model.Name), len(result), loc[1]-loc[0], weights)
+				context = loc[1] - loc[0] - (loc[3] - loc[2])
+			}
+			extracted.Values = append(extracted.Values, result)
+		}
+
+		if !model.Repeated && len(extracted.Values) > 0 {
+			break
+		}
+	}
+
+	if len(extracted.Values) == 0 {
+		return Extracted{}, 0, false
+	}
+
+	if !model.Repeated {
+		extracted.Values = nil
+	}
+
+	return extracted, context, true
+}
+
+// regex compiles the pattern that captures the token's value between its anchors.
+func (t TokenTrain) regex() (*regexp.Regexp, bool) {
+	// O valor só é preguiçoso quando existe um delimitador depois dele
+	valuePattern, ok := listPattern(t.Type, t.Repeated, t.hasAfter() && t.hasBefore())
+	if !ok {
+		return nil, false
+	}
+
+	// Construindo o padrão da expressão regular com base no modelo
+	regexPattern := t.beforePattern() + `(` + valuePattern + `)` + t.afterPattern()
+	if t.Type != "" {
+		regexPattern = t.beforePattern() + `\s*(` + valuePattern + `)\s*` + t.afterPattern()
+	}
+
+	regex, err := regexp.Compile(regexPattern)
+	if err != nil {
+		return nil, false
+	}
+
+	return regex, true
+}
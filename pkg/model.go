@@ -0,0 +1,245 @@
+package textextractor
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ModelVersion is the schema version of the Model written by this package.
+const ModelVersion = 1
+
+// Model is a set of learned tokens that can keep growing with new examples, along with
+// the settings it was trained with. Matchers are compiled once and reused across calls.
+type Model struct {
+	Name      string                `json:"name"`
+	Version   int                   `json:"version"`
+	Precision int                   `json:"precision"` // Precision of the extractor that trained the model
+	Context   ContextMode           `json:"context"`   // Context of the extractor that trained the model
+	Weights   PrecisionWeights      `json:"weights"`   // weights used to score extracted values
+	CreatedAt time.Time             `json:"createdAt"`
+	Tokens    []TokenTrain          `json:"tokens"`
+	Stats     map[string]TokenStats `json:"stats,omitempty"` // per token name
+
+	mu       sync.Mutex
+	compiled []*tokenMatcher
+}
+
+// TokenStats summarizes what a model has learned about one token.
+type TokenStats struct {
+	Examples int       `json:"examples"` // training examples behind the token
+	Anchors  int       `json:"anchors"`  // distinct contexts the token can be found with
+	LastSeen time.Time `json:"lastSeen"` // when the token was last merged into the model
+}
+
+// NewModel creates a model from learned tokens, recording the extractor's settings.
+func (n TextExtractor) NewModel(name string, tokens []TokenTrain) *Model {
+	m := &Model{
+		Name:      name,
+		Version:   ModelVersion,
+		Precision: n.Precision,
+		Context:   n.Context,
+		Weights:   n.Weights,
+		CreatedAt: time.Now(),
+		Tokens:    tokens,
+	}
+	m.updateStats()
+
+	return m
+}
+
+// Update merges newly learned tokens into the model. A token already in the model has
+// its support bumped instead of being added twice, a new context for a generalized token
+// becomes one more alternative, and everything merged is marked as seen now.
+func (m *Model) Update(tokens []TokenTrain) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	index := make(map[string]int, len(m.Tokens))
+	for i, token := range m.Tokens {
+		index[token.identity()] = i
+	}
+
+	for _, token := range tokens {
+		token.Support = support(token.Support)
+		token.LastSeen = now
+
+		if i, found := index[token.identity()]; found {
+			m.Tokens[i] = generalizeGroup([]TokenTrain{m.Tokens[i], token})
+			continue
+		}
+
+		// Tokens generalizados absorvem o novo contexto como mais uma alternativa
+		if i, found := m.generalized(token); found {
+			delete(index, m.Tokens[i].identity())
+			m.Tokens[i] = generalizeGroup([]TokenTrain{m.Tokens[i], token})
+			index[m.Tokens[i].identity()] = i
+			continue
+		}
+
+		index[token.identity()] = len(m.Tokens)
+		m.Tokens = append(m.Tokens, token)
+	}
+
+	m.updateStats()
+
+	// Os matchers são recompilados no próximo uso
+	m.compiled = nil
+}
+
+// LearnInto learns from the templates and merges the result into the model, so a model
+// can grow from daily corrections without retraining on the whole corpus. A model that
+// has no settings yet, such as &Model{}, records the extractor's.
+func (n TextExtractor) LearnInto(model *Model, input []string) error {
+	// O modelo continua aprendendo com as configurações do seu treino
+	model.mu.Lock()
+	if model.Precision == 0 {
+		model.Precision, model.Context = n.Precision, n.Context
+		if model.Weights == (PrecisionWeights{}) {
+			model.Weights = n.Weights
+		}
+	}
+	if model.Version == 0 {
+		model.Version = ModelVersion
+	}
+	if model.CreatedAt.IsZero() {
+		model.CreatedAt = time.Now()
+	}
+	n.Precision, n.Context = model.Precision, model.Context
+	model.mu.Unlock()
+
+	tokens, err := n.Learn(input)
+	if err != nil {
+		return err
+	}
+
+	model.Update(tokens)
+
+	return nil
+}
+
+// check reports tokens that can't extract anything, such as tokens using a filter that
+// is not registered.
+func (m *Model) check() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, token := range m.Tokens {
+		if err := checkFilters(token.Filters); err != nil {
+			return fmt.Errorf("token %s: %w", token.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// named returns the model itself if it has a name, or a copy of it called name.
+func (m *Model) named(name string) *Model {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.Name != "" {
+		return m
+	}
+
+	return &Model{
+		Name:      name,
+		Version:   m.Version,
+		Precision: m.Precision,
+		Context:   m.Context,
+		Weights:   m.Weights,
+		CreatedAt: m.CreatedAt,
+		Tokens:    m.Tokens,
+		Stats:     m.Stats,
+	}
+}
+
+// matchers returns the compiled tokens of the model, compiling them on first use.
+func (m *Model) matchers() []*tokenMatcher {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.compiled == nil {
+		m.compiled = make([]*tokenMatcher, 0, len(m.Tokens))
+		for _, token := range m.Tokens {
+			m.compiled = append(m.compiled, compileToken(token))
+		}
+	}
+
+	return m.compiled
+}
+
+// best extracts every token of the model from the input and keeps the most precise
+// value found for each token name.
+func (m *Model) best(input string, weights PrecisionWeights) map[string]Extracted {
+	values := make(map[string]Extracted)
+	for _, matcher := range m.matchers() {
+		extracted, have := matcher.extract(input, weights)
+		if !have {
+			continue
+		}
+
+		// Com a mesma precisão (sempre 0 sem Weights), o valor mais longo vence: um
+		// delimitador que também aparece dentro do valor não deve truncá-lo
+		existing, found := values[extracted.Token]
+		if !found || extracted.Precision > existing.Precision ||
+			(extracted.Precision == existing.Precision && len(extracted.Value) > len(existing.Value)) {
+			values[extracted.Token] = extracted
+		}
+	}
+
+	return values
+}
+
+// weights returns the weights the model was trained with, or fallback if it has none.
+func (m *Model) weights(fallback PrecisionWeights) PrecisionWeights {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.Weights != (PrecisionWeights{}) {
+		return m.Weights
+	}
+
+	return fallback
+}
+
+// updateStats recomputes the per token statistics from the tokens.
+func (m *Model) updateStats() {
+	m.Stats = make(map[string]TokenStats, len(m.Tokens))
+	for _, token := range m.Tokens {
+		stats := m.Stats[token.Name]
+		stats.Examples += support(token.Support)
+		stats.Anchors += 1 + len(token.Alternatives)
+		if token.LastSeen.After(stats.LastSeen) {
+			stats.LastSeen = token.LastSeen
+		}
+		m.Stats[token.Name] = stats
+	}
+}
+
+// generalized returns the generalized token of the model the token belongs to.
+func (m *Model) generalized(token TokenTrain) (int, bool) {
+	key := token.generalizeKey()
+	for i, t := range m.Tokens {
+		if len(t.Alternatives) > 0 && t.generalizeKey() == key {
+			return i, true
+		}
+	}
+
+	return 0, false
+}
+
+// identity identifies duplicate tokens: same placeholder and same anchors.
+func (t TokenTrain) identity() string {
+	var b strings.Builder
+	b.WriteString(t.generalizeKey())
+	fmt.Fprintf(&b, "\x00%q\x00%q\x00%d\x00%d\x00%s\x00%s", t.WordBefore, t.WordAfter, t.BeforeBoundary, t.AfterBoundary, t.Prev, t.Next)
+	fmt.Fprintf(&b, "\x00%q\x00%d\x00%q\x00%d", t.Lead, t.LeadGap, t.Trail, t.TrailGap)
+	for _, alt := range t.Alternatives {
+		fmt.Fprintf(&b, "\x00%q\x00%q\x00%d\x00%d", alt.WordBefore, alt.WordAfter, alt.BeforeBoundary, alt.AfterBoundary)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,336 @@
+package textextractor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// WriteModel writes the model to w in the given format, the encoding Save uses for a
+// file with the format's extension. JSON and YAML are written byte for byte the same;
+// gob writes maps in no particular order, so its bytes may differ between calls.
+func WriteModel(w io.Writer, model *Model, format Format) error {
+	codec, ok := codecs[format]
+	if !ok {
+		return fmt.Errorf("%w: format %q", ErrUnsupportedModel, format)
+	}
+
+	data, err := codec.encode(model)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+// ReadModel reads a model from r. The format is detected from the content: versioned or
+// legacy gob, JSON or YAML.
+func ReadModel(r io.Reader) (*Model, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	model, err := codecs[detect(data)].decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return model, model.check()
+}
+
+// LoadFS loads a model from fsys, e.g. an embed.FS. Like Load, the extension of name
+// picks the format and names without a known extension are read as .gob.
+func LoadFS(fsys fs.FS, name string) (*Model, error) {
+	return loadFS(fsys, name, nil)
+}
+
+// LoadFS loads a model from fsys like the package's LoadFS, checking it against its
+// .sig sidecar in fsys the way Load does.
+func (n TextExtractor) LoadFS(fsys fs.FS, name string) (*Model, error) {
+	return loadFS(fsys, name, n.verify)
+}
+
+// ReadModel reads a model from r like the package's ReadModel, checking it against the
+// signature read from sig the way Load does. sig is nil for an unsigned model.
+func (n TextExtractor) ReadModel(r, sig io.Reader) (*Model, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var signature []byte
+	if sig != nil {
+		if signature, err = io.ReadAll(sig); err != nil {
+			return nil, err
+		}
+	}
+	if err := n.checkSignature(data, signature); err != nil {
+		return nil, err
+	}
+
+	return ReadModel(bytes.NewReader(data))
+}
+
+// loadFS reads a model file from fsys, checking its bytes with verify when it is set.
+func loadFS(fsys fs.FS, name string, verify func(fsys fs.FS, name string, data []byte) error) (*Model, error) {
+	name, format := modelFile(name)
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		// O ModelFileError já nomeia o arquivo
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			err = pathErr.Err
+		}
+		return nil, &ModelFileError{File: name, Err: err}
+	}
+
+	// A assinatura é conferida antes de decodificar qualquer coisa
+	if verify != nil {
+		if err := verify(fsys, name, data); err != nil {
+			return nil, &ModelFileError{File: name, Err: err}
+		}
+	}
+
+	return readModelFile(data, name, strings.TrimSuffix(path.Base(name), path.Ext(name)), format)
+}
+
+// readModelFile decodes a model file, naming the file in errors. Models without a
+// name are named after the file.
+func readModelFile(data []byte, file, name string, format Format) (*Model, error) {
+	model, err := codecs[format].decode(data)
+	if err != nil {
+		return nil, &ModelFileError{File: file, Err: err}
+	}
+	if err := model.check(); err != nil {
+		return nil, &ModelFileError{File: file, Err: err}
+	}
+
+	if model.Name == "" {
+		model.Name = name
+	}
+
+	return model, nil
+}
+
+// detect picks the format of a model read without a file name.
+func detect(data []byte) Format {
+	switch {
+	case bytes.HasPrefix(data, modelMagic[:]):
+		return FormatGob
+	case bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")):
+		return FormatJSON
+	case bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data):
+		// Gob sem cabeçalho, salvo por versões antigas
+		return FormatGob
+	}
+
+	return FormatYAML
+}
+
+// writeFileAtomic writes a file through a temporary file in the same directory that is
+// synced and renamed over the target, so readers see either the old or the new file.
+func writeFileAtomic(filePath string, write func(w io.Writer) error) error {
+	tmp, err := writeTemp(filePath, write)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, filePath); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return syncDir(filepath.Dir(filePath))
+}
+
+// writeTemp writes a synced temporary file next to filePath and returns its name.
+func writeTemp(filePath string, write func(w io.Writer) error) (name string, err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	// O arquivo temporário é criado com 0600
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return "", err
+	}
+
+	return tmp.Name(), nil
+}
+
+// replacement is a file replaced by replaceFiles.
+type replacement struct {
+	path string
+	data []byte // nil removes the file
+	bak  string // where to keep the file being replaced, if set
+}
+
+// replaceFiles replaces several files as one, e.g. a model and its signature. Every new
+// file is written to a temporary file before any of them is touched, the first file is
+// renamed into place last, and if a step fails the files already replaced are restored.
+func replaceFiles(files ...replacement) (err error) {
+	tmps := make([]string, len(files))
+	defer func() {
+		for _, tmp := range tmps {
+			if tmp != "" {
+				os.Remove(tmp)
+			}
+		}
+	}()
+
+	for i, f := range files {
+		if f.data == nil {
+			continue
+		}
+		data := f.data
+		tmps[i], err = writeTemp(f.path, func(w io.Writer) error {
+			_, err := w.Write(data)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, f := range files {
+		if f.bak != "" {
+			if err := backupFile(f.path, f.bak); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Os arquivos antigos são guardados até que todos tenham sido trocados
+	var olds []string
+	defer func() {
+		for i, old := range olds {
+			f := files[len(files)-1-i]
+			if old == "" {
+				os.Remove(f.path)
+			} else {
+				os.Rename(old, f.path)
+			}
+		}
+	}()
+
+	for i := len(files) - 1; i >= 0; i-- {
+		old, err := keepOld(files[i].path)
+		if err != nil {
+			return err
+		}
+
+		if files[i].data == nil {
+			err = os.Remove(files[i].path)
+			if errors.Is(err, fs.ErrNotExist) {
+				err = nil
+			}
+		} else {
+			err = os.Rename(tmps[i], files[i].path)
+		}
+		if err != nil {
+			os.Remove(old)
+			return err
+		}
+		olds = append(olds, old)
+	}
+
+	for _, old := range olds {
+		if old != "" {
+			os.Remove(old)
+		}
+	}
+	olds = nil
+
+	for _, f := range files {
+		if err := syncDir(filepath.Dir(f.path)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// keepOld links the current file to a temporary name, so it can be restored. It returns
+// "" when there is no file.
+func keepOld(filePath string) (string, error) {
+	if _, err := os.Lstat(filePath); errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+
+	old := filepath.Join(filepath.Dir(filePath), "."+filepath.Base(filePath)+".old")
+	if err := backupFile(filePath, old); err != nil {
+		return "", err
+	}
+
+	return old, nil
+}
+
+// backupFile keeps a copy of the file at bak, if the file exists.
+func backupFile(filePath, bak string) error {
+	os.Remove(bak)
+
+	// Um hard link preserva o arquivo antigo sem copiá-lo
+	err := os.Link(filePath, bak)
+	if err == nil || errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(bak, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// backupPath is where Save keeps the previous version of a model file: people.json
+// is backed up as people.bak.json, which Load can still read.
+func backupPath(filePath string) string {
+	ext := filepath.Ext(filePath)
+	return strings.TrimSuffix(filePath, ext) + ".bak" + ext
+}
+
+// syncDir flushes a directory entry, making a rename inside it durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	// Alguns sistemas não permitem sincronizar diretórios
+	if err := d.Sync(); err != nil && !errors.Is(err, os.ErrInvalid) {
+		return err
+	}
+
+	return nil
+}
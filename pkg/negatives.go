@@ -0,0 +1,136 @@
+package textextractor
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// NegativeExample is a counter-example: a text the token must not be extracted from.
+// When Value is set, only that span is wrong and other values may still be extracted.
+type NegativeExample struct {
+	Token string
+	Text  string
+	Value string
+}
+
+// Negative is a saved constraint that rejects a match. A match is rejected when its
+// value equals Value, or when the text right before the match ends with Context.
+type Negative struct {
+	Context string `json:"context,omitempty"`
+	Value   string `json:"value,omitempty"`
+}
+
+// LearnWithNegatives learns from templates like Learn, then checks every token against the
+// counter-examples for it. A token that still matches a counter-example gets longer anchors
+// until it doesn't; when the anchors can't grow any further the false match is saved as a
+// Negative constraint, and the token is dropped if even that can't tell the match apart.
+func (n TextExtractor) LearnWithNegatives(input []string, negatives []NegativeExample) ([]TokenTrain, error) {
+	byToken := make(map[string][]NegativeExample)
+	for _, negative := range negatives {
+		byToken[negative.Token] = append(byToken[negative.Token], negative)
+	}
+
+	tokens := []TokenTrain{}
+	for i, text := range input {
+		tpl, err := ParseTemplate(text)
+		if err != nil {
+			return nil, fmt.Errorf("learn: template %d: %w", i, err)
+		}
+
+		for j, token := range n.learnTemplate(tpl) {
+			if token, ok := n.refine(tpl, j, token, byToken[token.Name]); ok {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+
+	return tokens, nil
+}
+
+// refine lengthens the anchors of the j-th token of the template until no counter-example
+// matches or they reach the edge of the line, falling back to negative constraints. It reports false when the token must be dropped.
+func (n TextExtractor) refine(tpl *Template, j int, token TokenTrain, negatives []NegativeExample) (TokenTrain, bool) {
+	longer := n
+	for len(n.falseMatches(token, negatives)) > 0 {
+		longer.Precision++
+		next := longer.learnTemplate(tpl)[j]
+		// O contexto só cresceu se mudou o texto ou a borda que o corta
+		if next.WordBefore == token.WordBefore && next.WordAfter == token.WordAfter &&
+			next.BeforeBoundary == token.BeforeBoundary && next.AfterBoundary == token.AfterBoundary {
+			break
+		}
+		token = next
+	}
+
+	for _, match := range n.falseMatches(token, negatives) {
+		negative := Negative{Value: match.value}
+		if match.negative.Value == "" {
+			negative = Negative{Context: lastRunes(match.negative.Text[:match.start], n.Precision)}
+		}
+		if negative.Context == "" && negative.Value == "" {
+			return TokenTrain{}, false
+		}
+		token.Negatives = append(token.Negatives, negative)
+	}
+
+	// A restrição precisa de fato descartar a correspondência errada
+	if len(n.falseMatches(token, negatives)) > 0 {
+		return TokenTrain{}, false
+	}
+
+	return token, true
+}
+
+type falseMatch struct {
+	negative NegativeExample
+	start    int
+	value    string
+}
+
+// falseMatches returns the matches of the token in the counter-examples.
+func (n TextExtractor) falseMatches(token TokenTrain, negatives []NegativeExample) []falseMatch {
+	regex, ok := token.regex()
+	if !ok || (!token.hasBefore() && !token.hasAfter()) {
+		return nil
+	}
+
+	var matches []falseMatch
+	for _, negative := range negatives {
+		for _, loc := range regex.FindAllStringSubmatchIndex(negative.Text, -1) {
+			value := strings.TrimSpace(negative.Text[loc[2]:loc[3]])
+			if value == "" || token.rejects(negative.Text, loc[0], value) {
+				continue
+			}
+			if negative.Value == "" || negative.Value == value {
+				matches = append(matches, falseMatch{negative: negative, start: loc[0], value: value})
+			}
+		}
+	}
+
+	return matches
+}
+
+// rejects reports whether a saved negative constraint discards the match starting at start.
+func (t TokenTrain) rejects(input string, start int, value string) bool {
+	for _, negative := range t.Negatives {
+		if negative.Value != "" && negative.Value == value {
+			return true
+		}
+		if negative.Context != "" && strings.HasSuffix(input[:start], negative.Context) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lastRunes returns the last n runes of s.
+func lastRunes(s string, n int) string {
+	for utf8.RuneCountInString(s) > n {
+		_, size := utf8.DecodeRuneInString(s)
+		s = s[size:]
+	}
+
+	return s
+}
@@ -0,0 +1,234 @@
+package textextractor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// registryFile is the index of a registered model, kept in ModelsDir/<name>/.
+const registryFile = "registry.json"
+
+// registryMu serializes the changes to registries, so concurrent Publish and Promote
+// calls don't overwrite each other's index.
+var registryMu sync.Mutex
+
+var (
+	// ErrNoRelease is returned for a model or version that was never published.
+	ErrNoRelease = errors.New("model release not found")
+	// ErrNoRollback is returned by Rollback when no version was promoted before the current one.
+	ErrNoRollback = errors.New("no previous release to roll back to")
+)
+
+// Release is one published version of a model in the registry.
+type Release struct {
+	Version     int                `json:"version"`
+	TrainingSet string             `json:"trainingSet,omitempty"` // hash of the training data, see HashTrainingSet
+	Scores      map[string]float64 `json:"scores,omitempty"`      // evaluation scores, e.g. "accuracy"
+	PublishedAt time.Time          `json:"publishedAt"`
+	Promoted    bool               `json:"-"` // set by List on the version Load resolves to
+}
+
+// registryIndex lists the releases of a model and which one is in use.
+type registryIndex struct {
+	Releases []Release `json:"releases"`
+	Promoted int       `json:"promoted"`
+	History  []int     `json:"history,omitempty"` // versions promoted before, oldest first
+}
+
+// HashTrainingSet identifies the training data a release was learned from.
+func HashTrainingSet(input []string) string {
+	h := sha256.New()
+	for _, text := range input {
+		fmt.Fprintf(h, "%d:%s", len(text), text)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Publish stores the model as the next version of name, keeping the versions published
+// before it. The first version is promoted right away; later ones are used by Load only
+// after Promote. A model without a name is saved under name; the model passed in is not modified.
+func (n TextExtractor) Publish(name string, model *Model, release Release) (Release, error) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	index, err := n.readRegistry(name)
+	if err != nil && !errors.Is(err, ErrNoRelease) {
+		return Release{}, err
+	}
+
+	release.Version = 1
+	if len(index.Releases) > 0 {
+		release.Version = index.Releases[len(index.Releases)-1].Version + 1
+	}
+	release.PublishedAt = time.Now()
+	release.Promoted = false
+
+	if err := n.Save(model.named(name), releaseFile(name, release.Version)); err != nil {
+		return Release{}, err
+	}
+
+	index.Releases = append(index.Releases, release)
+	if index.Promoted == 0 {
+		index.Promoted = release.Version
+		release.Promoted = true
+	}
+
+	return release, n.writeRegistry(name, index)
+}
+
+// List returns the published versions of name, oldest first.
+func (n TextExtractor) List(name string) ([]Release, error) {
+	index, err := n.readRegistry(name)
+	if err != nil {
+		return nil, err
+	}
+
+	releases := make([]Release, len(index.Releases))
+	for i, release := range index.Releases {
+		release.Promoted = release.Version == index.Promoted
+		releases[i] = release
+	}
+
+	return releases, nil
+}
+
+// Promote makes version the one Load resolves name to.
+func (n TextExtractor) Promote(name string, version int) error {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	index, err := n.readRegistry(name)
+	if err != nil {
+		return err
+	}
+
+	if _, found := index.release(version); !found {
+		return fmt.Errorf("textextractor: %s v%d: %w", name, version, ErrNoRelease)
+	}
+	if version == index.Promoted {
+		return nil
+	}
+
+	index.History = append(index.History, index.Promoted)
+	index.Promoted = version
+
+	return n.writeRegistry(name, index)
+}
+
+// Rollback promotes again the version that was in use before the current one.
+func (n TextExtractor) Rollback(name string) (Release, error) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	index, err := n.readRegistry(name)
+	if err != nil {
+		return Release{}, err
+	}
+
+	if len(index.History) == 0 {
+		return Release{}, fmt.Errorf("textextractor: %s: %w", name, ErrNoRollback)
+	}
+
+	index.Promoted = index.History[len(index.History)-1]
+	index.History = index.History[:len(index.History)-1]
+
+	release, _ := index.release(index.Promoted)
+	release.Promoted = true
+
+	return release, n.writeRegistry(name, index)
+}
+
+// promoted returns the file of the promoted version of name, if name is in the registry.
+// A registry that can't be read is an error, rather than a reason to load another file.
+func (n TextExtractor) promoted(name string) (string, bool, error) {
+	index, err := n.readRegistry(name)
+	if errors.Is(err, ErrNoRelease) {
+		return "", false, nil
+	}
+	if err != nil || index.Promoted == 0 {
+		return "", false, err
+	}
+
+	return releaseFile(name, index.Promoted), true, nil
+}
+
+// readRegistry reads the index of name, or returns ErrNoRelease if it was never published.
+func (n TextExtractor) readRegistry(name string) (registryIndex, error) {
+	var index registryIndex
+
+	dir, err := n.GetModelsDir()
+	if err != nil {
+		return index, err
+	}
+
+	// Um arquivo com o mesmo nome, como people.json, não é um registro
+	info, err := os.Stat(filepath.Join(dir, name))
+	if errors.Is(err, os.ErrNotExist) || (err == nil && !info.IsDir()) {
+		return index, fmt.Errorf("textextractor: %s: %w", name, ErrNoRelease)
+	}
+	if err != nil {
+		return index, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, name, registryFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return index, fmt.Errorf("textextractor: %s: %w", name, ErrNoRelease)
+	}
+	if err != nil {
+		return index, err
+	}
+
+	if err := json.Unmarshal(data, &index); err != nil {
+		return index, &ModelFileError{File: filepath.Join(dir, name, registryFile), Err: fmt.Errorf("%w: %v", ErrCorruptModel, err)}
+	}
+
+	sort.Slice(index.Releases, func(i, j int) bool {
+		return index.Releases[i].Version < index.Releases[j].Version
+	})
+
+	return index, nil
+}
+
+// writeRegistry replaces the index of name.
+func (n TextExtractor) writeRegistry(name string, index registryIndex) error {
+	dir, err := n.GetModelsDir()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(filepath.Join(dir, name, registryFile), func(w io.Writer) error {
+		_, err := w.Write(append(data, '\n'))
+		return err
+	})
+}
+
+// release returns the release with the given version.
+func (index registryIndex) release(version int) (Release, bool) {
+	for _, release := range index.Releases {
+		if release.Version == version {
+			return release, true
+		}
+	}
+
+	return Release{}, false
+}
+
+// releaseFile is the model file of a version, relative to ModelsDir.
+func releaseFile(name string, version int) string {
+	return filepath.Join(name, fmt.Sprintf("v%d", version))
+}
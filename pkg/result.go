@@ -0,0 +1,92 @@
+package textextractor
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+)
+
+// Result holds the value extracted for each token of a document, ordered by token name.
+type Result []Extracted
+
+// ExtractAll extracts every token of the model from input, keeping the most precise value
+// of each token, for documents with no Go struct to unmarshal into.
+func ExtractAll(model *Model, input string) (Result, error) {
+	if model == nil {
+		return nil, ErrNilModel
+	}
+	if err := model.check(); err != nil {
+		return nil, err
+	}
+
+	values := model.best(input, model.weights(PrecisionWeights{}))
+	result := make(Result, 0, len(values))
+	for _, extracted := range values {
+		result = append(result, extracted)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Token < result[j].Token
+	})
+
+	return result, nil
+}
+
+// Get returns the value extracted for a token.
+func (r Result) Get(token string) (Extracted, bool) {
+	i := sort.Search(len(r), func(i int) bool { return r[i].Token >= token })
+	if i < len(r) && r[i].Token == token {
+		return r[i], true
+	}
+
+	return Extracted{}, false
+}
+
+// ToMap returns the values by token: a string, or a []string for repeated tokens.
+func (r Result) ToMap() map[string]interface{} {
+	m := make(map[string]interface{}, len(r))
+	for _, extracted := range r {
+		m[extracted.Token] = extracted.value()
+	}
+
+	return m
+}
+
+// MarshalJSON writes the result as an object keyed by token, in order, with the value
+// and precision of each token.
+func (r Result) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, extracted := range r {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		key, err := json.Marshal(extracted.Token)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(struct {
+			Value     interface{} `json:"value"`
+			Precision float64     `json:"precision"`
+		}{extracted.value(), extracted.Precision})
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// value returns every occurrence of a repeated token, or the single value otherwise.
+func (e Extracted) value() interface{} {
+	if e.Values != nil {
+		return e.Values
+	}
+
+	return e.Value
+}
@@ -0,0 +1,94 @@
+package textextractor
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"io/fs"
+	"strings"
+)
+
+var (
+	// ErrUnsignedModel is returned by Load when RequireSignature is set and the model has no signature.
+	ErrUnsignedModel = errors.New("model is not signed")
+	// ErrSignatureMismatch is returned by Load when the model does not match its signature.
+	ErrSignatureMismatch = errors.New("model signature does not match")
+	// ErrNoVerifyKey is returned by Load when RequireSignature is set without a key to check it.
+	ErrNoVerifyKey = errors.New("signature required but no VerifyKey set")
+	// ErrInvalidSigningKey is returned by Save, before writing anything, when SigningKey is not an ed25519 private key.
+	ErrInvalidSigningKey = errors.New("invalid SigningKey size")
+)
+
+// signaturePath is the sidecar file holding the signature of a model file.
+func signaturePath(filePath string) string {
+	return filePath + ".sig"
+}
+
+// signature signs the bytes of a model file with SigningKey. Without a key there is no
+// signature.
+func (n TextExtractor) signature(data []byte) ([]byte, error) {
+	if n.SigningKey == nil {
+		return nil, nil
+	}
+	if len(n.SigningKey) != ed25519.PrivateKeySize {
+		return nil, ErrInvalidSigningKey
+	}
+
+	return []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(n.SigningKey, data)) + "\n"), nil
+}
+
+// verify checks a model file in fsys against its signature sidecar.
+func (n TextExtractor) verify(fsys fs.FS, name string, data []byte) error {
+	if n.verifyKey() == nil {
+		return n.checkSignature(data, nil)
+	}
+
+	sig, err := fs.ReadFile(fsys, signaturePath(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return n.checkSignature(data, nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	return n.checkSignature(data, sig)
+}
+
+// checkSignature checks the bytes of a model against a signature, nil for an unsigned
+// model. Without a key there is nothing to check; an unsigned model is accepted unless
+// RequireSignature is set.
+func (n TextExtractor) checkSignature(data, sig []byte) error {
+	key := n.verifyKey()
+	if key == nil {
+		if n.RequireSignature {
+			return ErrNoVerifyKey
+		}
+		return nil
+	}
+
+	if sig == nil {
+		if n.RequireSignature {
+			return ErrUnsignedModel
+		}
+		return nil
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+	if err != nil || len(key) != ed25519.PublicKeySize || !ed25519.Verify(key, data, signature) {
+		return ErrSignatureMismatch
+	}
+
+	return nil
+}
+
+// verifyKey returns VerifyKey, or the public half of SigningKey.
+func (n TextExtractor) verifyKey() ed25519.PublicKey {
+	if n.VerifyKey != nil {
+		return n.VerifyKey
+	}
+	if len(n.SigningKey) == ed25519.PrivateKeySize {
+		return n.SigningKey.Public().(ed25519.PublicKey)
+	}
+
+	return nil
+}
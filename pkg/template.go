@@ -0,0 +1,317 @@
+package textextractor
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/devalexandre/textextractor/pkg/internal/parser"
+)
+
+// Position is a location in a template, line and column start at 1.
+type Position struct {
+	Line   int
+	Column int
+	Offset int
+}
+
+// Node is a part of a parsed template: a *Literal or a *Placeholder.
+type Node interface {
+	node()
+}
+
+// Literal is plain template text, with escaped braces already resolved.
+type Literal struct {
+	Text string
+	Pos  Position
+}
+
+// Template is the syntax tree of a template such as "DOB: {DOB:date}".
+type Template struct {
+	Nodes []Node
+}
+
+// SyntaxError is returned for malformed templates.
+type SyntaxError struct {
+	Line   int
+	Column int
+	Offset int
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("template: line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+func (*Literal) node()     {}
+func (*Placeholder) node() {}
+
+// ParseTemplate parses a template into literal and placeholder nodes.
+// Use \{ and \} for literal braces.
+func ParseTemplate(input string) (*Template, error) {
+	nodes, err := parser.ParseTemplate(input)
+	if err != nil {
+		if e, ok := err.(*parser.Error); ok {
+			return nil, newSyntaxError(e.Pos, e.Msg)
+		}
+		return nil, err
+	}
+
+	tpl := &Template{}
+	for _, node := range nodes {
+		switch node := node.(type) {
+		case *parser.Literal:
+			tpl.Nodes = append(tpl.Nodes, &Literal{Text: node.Text, Pos: Position(node.Pos)})
+		case *parser.Placeholder:
+			if _, ok := typePattern(node.Type, false); !ok {
+				return nil, newSyntaxError(node.TypePos, fmt.Sprintf("unknown placeholder type %q", node.Type))
+			}
+
+			var chain []Filter
+			for _, f := range node.Filters {
+				registered, ok := lookupFilter(f.Name)
+				if !ok {
+					return nil, newSyntaxError(f.Pos, fmt.Sprintf("unknown filter %q", f.Name))
+				}
+				if err := registered.checkArgs(f.Args); err != nil {
+					return nil, newSyntaxError(f.Pos, fmt.Sprintf("filter %q: %v", f.Name, err))
+				}
+				chain = append(chain, Filter{Name: f.Name, Args: f.Args})
+			}
+
+			tpl.Nodes = append(tpl.Nodes, &Placeholder{
+				Name:     node.Name,
+				Type:     node.Type,
+				Optional: node.Optional,
+				Repeated: node.Repeated,
+				Filters:  chain,
+				Raw:      node.Raw,
+				Pos:      Position(node.Pos),
+			})
+		}
+	}
+
+	return tpl, nil
+}
+
+// Placeholders returns the placeholders of the template in order.
+func (t *Template) Placeholders() []Placeholder {
+	var placeholders []Placeholder
+	for _, node := range t.Nodes {
+		if p, ok := node.(*Placeholder); ok {
+			placeholders = append(placeholders, *p)
+		}
+	}
+
+	return placeholders
+}
+
+// render returns the template text, with placeholders written as they were in the
+// template, and the [start, end) offsets of every placeholder in that text.
+func (t *Template) render() (string, [][2]int) {
+	var b strings.Builder
+	var spans [][2]int
+	for _, node := range t.Nodes {
+		switch node := node.(type) {
+		case *Literal:
+			b.WriteString(node.Text)
+		case *Placeholder:
+			start := b.Len()
+			b.WriteString(node.Raw)
+			spans = append(spans, [2]int{start, b.Len()})
+		}
+	}
+
+	return b.String(), spans
+}
+
+func newSyntaxError(pos parser.Position, msg string) *SyntaxError {
+	return &SyntaxError{Line: pos.Line, Column: pos.Column, Offset: pos.Offset, Msg: msg}
+}
+
+// ErrNoMatch is returned by MatchTemplate when the input does not follow the template.
+var ErrNoMatch = errors.New("textextractor: input does not match the template")
+
+// maxCompiledTemplates bounds the cache of compiled templates.
+const maxCompiledTemplates = 256
+
+// compiledTemplates caches CompileTemplate results by template text. When it is full an
+// arbitrary entry is evicted, so templates built at runtime can't grow it without bound.
+var compiledTemplates = struct {
+	sync.Mutex
+	entries map[string]*compiledTemplate
+}{entries: make(map[string]*compiledTemplate)}
+
+type compiledTemplate struct {
+	regex        *regexp.Regexp
+	placeholders map[string]Placeholder
+}
+
+// CompileTemplate compiles a whole template into one anchored regular expression.
+// Literal text is quoted, whitespace runs match any whitespace and every placeholder
+// becomes a named group that only matches its type.
+func (n TextExtractor) CompileTemplate(template string) (*regexp.Regexp, error) {
+	compiled, err := compileTemplate(template)
+	if err != nil {
+		return nil, err
+	}
+
+	return compiled.regex, nil
+}
+
+// MatchTemplate matches the whole input against the template in one pass and returns
+// the value of every placeholder, with filters applied.
+func (n TextExtractor) MatchTemplate(template, input string) (map[string]Extracted, error) {
+	compiled, err := compileTemplate(template)
+	if err != nil {
+		return nil, err
+	}
+
+	match := compiled.regex.FindStringSubmatch(input)
+	if match == nil {
+		return nil, ErrNoMatch
+	}
+
+	values := make(map[string]Extracted)
+	for i, name := range compiled.regex.SubexpNames() {
+		if name == "" || match[i] == "" {
+			continue
+		}
+		if _, found := values[name]; found {
+			continue
+		}
+
+		p := compiled.placeholders[name]
+		result := strings.TrimSpace(match[i])
+		extracted := Extracted{Token: name}
+
+		for _, value := range splitList(p.Type, p.Repeated, result) {
+			value, err = applyFilters(value, p.Filters)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			extracted.Values = append(extracted.Values, value)
+		}
+
+		extracted.Value = extracted.Values[0]
+		extracted.Precision = calculatePrecision(extracted.Value, len(name), len(extracted.Value), len(match[0]), n.Weights)
+		if !p.Repeated {
+			extracted.Values = nil
+		}
+
+		values[name] = extracted
+	}
+
+	return values, nil
+}
+
+func compileTemplate(template string) (*compiledTemplate, error) {
+	compiledTemplates.Lock()
+	cached, ok := compiledTemplates.entries[template]
+	compiledTemplates.Unlock()
+	if ok {
+		return cached, nil
+	}
+
+	tpl, err := ParseTemplate(template)
+	if err != nil {
+		return nil, err
+	}
+
+	compiled := &compiledTemplate{placeholders: make(map[string]Placeholder)}
+
+	var b strings.Builder
+	b.WriteString(`^\s*`)
+	for i, node := range tpl.Nodes {
+		switch node := node.(type) {
+		case *Literal:
+			pattern := literalPattern(node.Text)
+			// Um placeholder opcional vazio não deixa espaço entre os literais
+			if optionalAt(tpl.Nodes, i-1) && strings.HasPrefix(pattern, `\s+`) {
+				pattern = `\s*` + strings.TrimPrefix(pattern, `\s+`)
+			}
+			if optionalAt(tpl.Nodes, i+1) && strings.HasSuffix(pattern, `\s+`) {
+				pattern = strings.TrimSuffix(pattern, `\s+`) + `\s*`
+			}
+			b.WriteString(pattern)
+		case *Placeholder:
+			if _, found := compiled.placeholders[node.Name]; found {
+				return nil, &SyntaxError{Line: node.Pos.Line, Column: node.Pos.Column, Offset: node.Pos.Offset,
+					Msg: fmt.Sprintf("duplicate placeholder %q, use {%s*} for repeated values", node.Name, node.Name)}
+			}
+			b.WriteString(placeholderGroup(*node))
+			compiled.placeholders[node.Name] = *node
+		}
+	}
+	b.WriteString(`\s*$`)
+
+	compiled.regex, err = regexp.Compile(b.String())
+	if err != nil {
+		return nil, err
+	}
+
+	compiledTemplates.Lock()
+	if len(compiledTemplates.entries) >= maxCompiledTemplates {
+		for key := range compiledTemplates.entries {
+			delete(compiledTemplates.entries, key)
+			break
+		}
+	}
+	compiledTemplates.entries[template] = compiled
+	compiledTemplates.Unlock()
+
+	return compiled, nil
+}
+
+// optionalAt reports whether the i-th node is an optional placeholder.
+func optionalAt(nodes []Node, i int) bool {
+	if i < 0 || i >= len(nodes) {
+		return false
+	}
+
+	p, ok := nodes[i].(*Placeholder)
+	return ok && p.Optional
+}
+
+// literalPattern quotes literal text, letting every whitespace run match any whitespace.
+func literalPattern(text string) string {
+	var b strings.Builder
+	for i, word := range strings.Fields(text) {
+		if i > 0 {
+			b.WriteString(`\s+`)
+		}
+		b.WriteString(regexp.QuoteMeta(word))
+	}
+
+	if b.Len() == 0 {
+		if text == "" {
+			return ""
+		}
+		return `\s+`
+	}
+
+	pattern := b.String()
+	if strings.TrimLeftFunc(text, unicode.IsSpace) != text {
+		pattern = `\s+` + pattern
+	}
+	if strings.TrimRightFunc(text, unicode.IsSpace) != text {
+		pattern += `\s+`
+	}
+
+	return pattern
+}
+
+// placeholderGroup returns the named group of a placeholder in a compiled template.
+func placeholderGroup(p Placeholder) string {
+	pattern, _ := listPattern(p.Type, p.Repeated, true)
+
+	group := `(?P<` + p.Name + `>` + pattern + `)`
+	if p.Optional {
+		group += `?`
+	}
+
+	return group
+}
@@ -1,37 +1,85 @@
 package textextractor
 
 import (
-	"encoding/gob"
+	"bytes"
+	"crypto/ed25519"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"reflect"
 	"regexp"
 	"strings"
+	"time"
 )
 
 type PrecisionWeights struct {
-	WordLengthWeight     float64
-	TokenLengthWeight    float64
-	CharacterCountWeight float64
+	WordLengthWeight     float64 `json:"wordLength"`
+	TokenLengthWeight    float64 `json:"tokenLength"`
+	CharacterCountWeight float64 `json:"characterCount"`
 }
 
 type TokenTrain struct {
-	Name       string
-	WordBefore string
-	WordAfter  string
+	Name       string      `json:"name"`
+	Type       string      `json:"type,omitempty"`     // placeholder type, e.g. "date" in {DOB:date}; empty means untyped
+	Optional   bool        `json:"optional,omitempty"` // {AKA?}: the value may be missing from the document
+	Repeated   bool        `json:"repeated,omitempty"` // {Phone*}: every occurrence of the value is extracted
+	Filters    []Filter    `json:"filters,omitempty"`
+	Context    ContextMode `json:"context,omitempty"` // how WordBefore and WordAfter were measured
+	WordBefore string      `json:"wordBefore"`
+	WordAfter  string      `json:"wordAfter"`
+	// BeforeBoundary and AfterBoundary mark anchors cut short by the start or end of the text or of a line.
+	BeforeBoundary Boundary `json:"beforeBoundary,omitempty"`
+	AfterBoundary  Boundary `json:"afterBoundary,omitempty"`
+	// TextBefore and TextAfter are the rest of the line around the token when no other
+	// placeholder stands in between and the anchors didn't reach the edge. Generalize aligns on them.
+	TextBefore string `json:"textBefore,omitempty"`
+	TextAfter  string `json:"textAfter,omitempty"`
+	// Lead and Trail are the text every line of a generalized token starts and ends with,
+	// apart from WordBefore and WordAfter by up to LeadGap and TrailGap words.
+	Lead     string `json:"lead,omitempty"`
+	LeadGap  int    `json:"leadGap,omitempty"`
+	Trail    string `json:"trail,omitempty"`
+	TrailGap int    `json:"trailGap,omitempty"`
+	Prev     string `json:"prev,omitempty"` // name of the placeholder right before this one in the template, if any
+	Next     string `json:"next,omitempty"` // name of the placeholder right after this one in the template, if any
+	// Alternatives are the contexts a generalized token was seen with, most supported first.
+	Alternatives []Anchor   `json:"alternatives,omitempty"`
+	Support      int        `json:"support,omitempty"`   // number of training examples behind the token
+	LastSeen     time.Time  `json:"lastSeen"`            // when the token was last merged into a Model; omitted when zero
+	Negatives    []Negative `json:"negatives,omitempty"` // matches learned to be wrong, see LearnWithNegatives
+}
+
+// Placeholder is a token found in a template, e.g. {Total:money}.
+type Placeholder struct {
+	Name     string
+	Type     string
+	Optional bool
+	Repeated bool
+	Filters  []Filter
+	Raw      string // the placeholder as written in the template, braces included
+	Pos      Position
 }
 
 type Extracted struct {
 	Token     string
 	Value     string
-	Precision float64
+	Values    []string // every occurrence, for repeated tokens
+	Precision float64  // weighted mean of the value and token name lengths; 0 without Weights
 }
 
 type TextExtractor struct {
 	ModelsDir string
-	Precision int
+	Precision int              // size of the anchors: characters, or words with WordContext
+	Context   ContextMode      // how Learn measures the anchors around a token
 	Weights   PrecisionWeights // Adicionado para armazenar os pesos de precisão
+	Backup    bool             // Save keeps the previous model file as <name>.bak.<ext>
+	// SigningKey signs every model Save writes, in a <file>.sig sidecar.
+	SigningKey ed25519.PrivateKey
+	// VerifyKey checks the signature of models read by Load; it defaults to the public half of SigningKey.
+	VerifyKey ed25519.PublicKey
+	// RequireSignature makes Load reject unsigned models.
+	RequireSignature bool
 }
 
 func NewTextExtractor() *TextExtractor {
@@ -41,275 +89,369 @@ func NewTextExtractor() *TextExtractor {
 	}
 }
 
-// ExtractTokens usando um analisador personalizado
-
-// ExtractTokens usando um analisador personalizado
+// ExtractTokens returns the names of the placeholders found in the input.
 func (n TextExtractor) ExtractTokens(input string) []string {
 	var tokens []string
-	var tokenBuffer string
-	insideToken := false
-
-	for _, char := range input {
-		switch char {
-		case '{':
-			insideToken = true
-			tokenBuffer = ""
-		case '}':
-			if insideToken {
-				tokens = append(tokens, tokenBuffer)
-				insideToken = false
-			}
-		default:
-			if insideToken {
-				tokenBuffer += string(char)
-			}
-		}
+	for _, p := range n.ExtractPlaceholders(input) {
+		tokens = append(tokens, p.Name)
 	}
 
 	return tokens
 }
 
-// GenerateRegex generates regex patterns for tokens
+// ExtractPlaceholders returns the placeholders of the input, or nil if it is not a valid template.
+func (n TextExtractor) ExtractPlaceholders(input string) []Placeholder {
+	tpl, err := ParseTemplate(input)
+	if err != nil {
+		return nil
+	}
+
+	return tpl.Placeholders()
+}
+
+// GenerateRegex generates regex patterns for tokens.
+// A token may carry a type ("DOB:date"), in which case the group matches that type.
 func (n TextExtractor) GenerateRegex(tokens []string) []string {
 	regex := []string{}
 	for _, token := range tokens {
-		regex = append(regex, `(?P<`+token+`>[^\s]+)`)
+		name, typ := splitTokenType(token)
+		pattern, ok := typePattern(typ, false)
+		if typ == "" || !ok {
+			pattern = `[^\s]+`
+		}
+		regex = append(regex, `(?P<`+name+`>`+pattern+`)`)
 	}
 
 	return regex
 }
 
-// GetBeforeToken returns the 5 characters before the token in the input string.
+// GetBeforeToken returns the Precision characters (or words, with WordContext) before the token in the input string.
 func (n TextExtractor) GetBeforeToken(input string, token string) string {
-	// Define the regular expression to find the token and the 5 characters before it.
-	regexValue := fmt.Sprintf(`(.{%v})%s`, n.Precision, regexp.QuoteMeta(token))
-	regex := regexp.MustCompile(regexValue)
+	index := strings.Index(input, token)
 
-	// Find the first match in the input string.
-	match := regex.FindStringSubmatch(input)
-
-	// If there is no match or the token is at the beginning of the string, return empty.
-	if len(match) < 2 {
+	// If there is no match, return empty.
+	if index < 0 {
 		return ""
 	}
 
-	// Return the 5 characters before the token.
-	return match[1]
+	anchor, _ := n.beforeAt(input, index)
+	return anchor
 }
 
-// GetAfterToken returns the 5 characters after the token in the input string.
+// GetAfterToken returns the Precision characters (or words, with WordContext) after the token in the input string.
 func (n TextExtractor) GetAfterToken(input string, token string) string {
-	// Define the regular expression to find the token and the 5 characters after it.
-	regexValue := fmt.Sprintf(`%s(.{%v})`, regexp.QuoteMeta(token), n.Precision)
-	regex := regexp.MustCompile(regexValue)
-
-	// Find the first match in the input string.
-	match := regex.FindStringSubmatch(input)
+	index := strings.Index(input, token)
 
-	// If there is no match or the token is at the end of the string, return empty.
-	if len(match) < 2 {
+	// If there is no match, return empty.
+	if index < 0 {
 		return ""
 	}
 
-	// Return the 5 characters after the token.
-	return match[1]
+	anchor, _ := n.afterAt(input, index+len(token))
+	return anchor
 }
 
 func (n TextExtractor) GetValueBetweenTokens(input string, model TokenTrain, weights PrecisionWeights) (Extracted, bool) {
-	// Verifica se os campos WordBefore e WordAfter são válidos
-	if model.WordBefore == "" && model.WordAfter == "" {
-		return Extracted{}, false
-	}
+	return compileToken(model).extract(input, weights)
+}
 
-	escapedWordBefore := regexp.QuoteMeta(model.WordBefore)
-	escapedWordAfter := regexp.QuoteMeta(model.WordAfter)
-	var regexPattern string
+// GetAdjacentValues extracts two neighbouring tokens together, using the text learned
+// between them as the delimiter. first.Next must be second.Name.
+func (n TextExtractor) GetAdjacentValues(input string, first, second TokenTrain, weights PrecisionWeights) (Extracted, Extracted, bool) {
+	if first.Next != second.Name || second.Prev != first.Name {
+		return Extracted{}, Extracted{}, false
+	}
 
-	// Construindo o padrão da expressão regular com base no modelo
-	if len(model.WordAfter) == 0 {
-		regexPattern = escapedWordBefore + `(.+)`
-	} else if len(model.WordBefore) == 0 {
-		regexPattern = `(.+)` + escapedWordAfter
-	} else {
-		regexPattern = escapedWordBefore + `(.+?)` + escapedWordAfter
+	firstPattern, ok := typePattern(first.Type, true)
+	if !ok {
+		return Extracted{}, Extracted{}, false
+	}
+	secondPattern, ok := typePattern(second.Type, second.hasAfter())
+	if !ok {
+		return Extracted{}, Extracted{}, false
 	}
 
-	// Verifica se o padrão da expressão regular é válido
-	regex, err := regexp.Compile(regexPattern)
+	regex, err := regexp.Compile(first.beforePattern() +
+		`(` + firstPattern + `)` + anchorPattern(first.WordAfter, first.Context) +
+		`(` + secondPattern + `)` + second.afterPattern())
 	if err != nil {
-		return Extracted{}, false
+		return Extracted{}, Extracted{}, false
 	}
 
-	// Encontrando a correspondência
 	match := regex.FindStringSubmatch(input)
-	if len(match) < 2 || match[1] == "" {
-		return Extracted{}, false
+	if len(match) < 3 {
+		return Extracted{}, Extracted{}, false
 	}
 
-	result := strings.TrimSpace(match[1])
-
-	// Calculando a precisão
-	precision := calculatePrecision(result, len(model.Name), len(result), len(match[0]), weights)
+	firstValue, ok := finishValue(first, match[1])
+	if !ok {
+		return Extracted{}, Extracted{}, false
+	}
+	secondValue, ok := finishValue(second, match[2])
+	if !ok {
+		return Extracted{}, Extracted{}, false
+	}
 
 	return Extracted{
-		Token:     model.Name,
-		Value:     result,
-		Precision: precision,
+		Token:     first.Name,
+		Value:     firstValue,
+		Precision: calculatePrecision(firstValue, len(first.Name), len(firstValue), len(match[0]), weights),
+	}, Extracted{
+		Token:     second.Name,
+		Value:     secondValue,
+		Precision: calculatePrecision(secondValue, len(second.Name), len(secondValue), len(match[0]), weights),
 	}, true
 }
 
-// GetValue extracts values using a trained model, and if not found, it tries the next token using recursion.
-// GetValue extrai valores usando um modelo treinado, e se não encontrado, tenta o próximo token usando recursão.
-func (n TextExtractor) GetValue(input string, model []TokenTrain) (Extracted, bool) {
-	if len(model) == 0 {
+// GetValue extracts the first value found by the tokens of a trained model.
+// When every token of the model is optional, a missing value is returned as an empty Extracted.
+func (n TextExtractor) GetValue(input string, model *Model) (Extracted, bool) {
+	if model == nil {
 		return Extracted{}, false
 	}
 
-	extracted, have := n.GetValueBetweenTokens(input, model[0], n.Weights)
-	if have {
-		return extracted, true
+	matchers := model.matchers()
+	if len(matchers) == 0 {
+		return Extracted{}, false
 	}
 
-	return n.GetValue(input, model[1:])
+	weights := model.weights(n.Weights)
+	for _, m := range matchers {
+		if extracted, have := m.extract(input, weights); have {
+			return extracted, true
+		}
+	}
+
+	if allOptional(matchers) {
+		return Extracted{Token: matchers[0].token.Name}, true
+	}
+
+	return Extracted{}, false
 }
 
 // Learn generates token training data from input strings.
-func (n TextExtractor) Learn(input []string) []TokenTrain {
+// A malformed template fails the whole call with a *SyntaxError.
+func (n TextExtractor) Learn(input []string) ([]TokenTrain, error) {
 	tokens := []TokenTrain{}
 
-	for _, i := range input {
-		t := TokenTrain{}
-		// Can have more than one token in the same string
-		for _, token := range n.ExtractTokens(i) {
-			t.Name = token
-			t.WordBefore = n.GetBeforeToken(i, fmt.Sprintf("{%s}", token))
-			t.WordAfter = n.GetAfterToken(i, fmt.Sprintf("{%s}", token))
-			tokens = append(tokens, t)
+	for i, text := range input {
+		tpl, err := ParseTemplate(text)
+		if err != nil {
+			return nil, fmt.Errorf("learn: template %d: %w", i, err)
+		}
+
+		tokens = append(tokens, n.learnTemplate(tpl)...)
+	}
+
+	return tokens, nil
+}
+
+// learnTemplate generates token training data from a parsed template.
+func (n TextExtractor) learnTemplate(tpl *Template) []TokenTrain {
+	tokens := []TokenTrain{}
+	text, spans := tpl.render()
+	placeholders := tpl.Placeholders()
+
+	// Can have more than one token in the same string
+	for i, p := range placeholders {
+		// Os contextos param na borda dos placeholders vizinhos
+		lo, hi := 0, len(text)
+		t := TokenTrain{
+			Name:     p.Name,
+			Type:     p.Type,
+			Optional: p.Optional,
+			Repeated: p.Repeated,
+			Filters:  p.Filters,
+			Context:  n.Context,
+		}
+		if i > 0 {
+			lo = spans[i-1][1]
+			t.Prev = placeholders[i-1].Name
+		}
+		if i < len(placeholders)-1 {
+			hi = spans[i+1][0]
+			t.Next = placeholders[i+1].Name
+		}
+
+		t.WordBefore, t.BeforeBoundary = n.anchorBefore(text, lo, spans[i][0])
+		t.WordAfter, t.AfterBoundary = n.anchorAfter(text, spans[i][1], hi)
+		if t.BeforeBoundary == NoBoundary {
+			t.TextBefore = lineBefore(text, lo, spans[i][0])
 		}
+		if t.AfterBoundary == NoBoundary {
+			t.TextAfter = lineAfter(text, spans[i][1], hi)
+		}
+		tokens = append(tokens, t)
 	}
 
 	return tokens
 }
 
-// Save saves tokens to a .gob file in the "models" folder.
-func (n TextExtractor) Save(tokens []TokenTrain, filename string) error {
+// Save saves a model to a file in the "models" folder. The extension picks the format:
+// .json and .yaml are readable and diff-friendly, anything else is saved as .gob behind a
+// versioned header. With a SigningKey, the file is signed in a .sig sidecar.
+func (n TextExtractor) Save(model *Model, filename string) error {
 	// Determine the absolute path to the "models" directory at the project's root.
 	dir, err := n.GetModelsDir()
 	if err != nil {
 		return err
 	}
 
-	// Ensure that the "models" directory exists; create it if it doesn't.
-	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
-		return err
-	}
-
 	// Create the full file path within the "models" directory.
-	filePath := filepath.Join(dir, fmt.Sprintf("%s.gob", filename))
+	filename, format := modelFile(filename)
+	filePath := filepath.Join(dir, filename)
 
-	// Open the file for writing (or create it if it doesn't exist).
-	file, err := os.Create(filePath)
+	// Encode the model in the format of the file extension, and sign it when a
+	// SigningKey is set, before anything is written.
+	var buf bytes.Buffer
+	if err := WriteModel(&buf, model, format); err != nil {
+		return err
+	}
+	data := buf.Bytes()
+	signature, err := n.signature(data)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-
-	// Create a Gob encoder.
-	encoder := gob.NewEncoder(file)
 
-	// Encode the tokens into Gob and write to the file.
-	if err := encoder.Encode(tokens); err != nil {
+	// Ensure that the "models" directory exists; create it if it doesn't.
+	if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
 		return err
 	}
 
-	return nil
+	// Write the model and its signature to temporary files and rename them into place
+	// together, so a failed save never leaves a truncated model, or a model next to the
+	// signature of another. Without a SigningKey, a stale signature is removed.
+	file, sig := replacement{path: filePath, data: data}, replacement{path: signaturePath(filePath), data: signature}
+	if n.Backup {
+		file.bak, sig.bak = backupPath(filePath), signaturePath(backupPath(filePath))
+	}
+
+	return replaceFiles(file, sig)
 }
 
-// Load loads tokens from a .gob file in the "models" folder.
-func (n TextExtractor) Load(filename string) ([]TokenTrain, error) {
+// Load loads a model saved by Save, upgrading older formats. A name published to the
+// registry loads its promoted version. With a verification key, a signed model must match
+// its signature.
+func (n TextExtractor) Load(filename string) (*Model, error) {
 	// Determine the absolute path to the "models" directory at the project's root.
 	modelsDir, err := n.GetModelsDir()
 	if err != nil {
 		return nil, err
 	}
 
-	// Create the full file path within the "models" directory.
-	filePath := filepath.Join(modelsDir, fmt.Sprintf("%s.gob", filename))
-
-	// Open the file for reading.
-	file, err := os.Open(filePath)
+	// Models published to the registry resolve to their promoted version.
+	release, ok, err := n.promoted(filename)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
-
-	// Create a Gob decoder.
-	decoder := gob.NewDecoder(file)
+	if ok {
+		filename = release
+	}
 
-	// Decode the Gob into a slice of tokens.
-	tokens := []TokenTrain{}
-	if err := decoder.Decode(&tokens); err != nil {
-		return nil, err
+	// Read the file from the "models" directory, checking its signature.
+	model, err := n.LoadFS(os.DirFS(modelsDir), filepath.ToSlash(filename))
+	var fileErr *ModelFileError
+	if errors.As(err, &fileErr) {
+		fileErr.File = filepath.Join(modelsDir, filepath.FromSlash(fileErr.File))
 	}
 
-	return tokens, nil
+	return model, err
+}
+
+// ParseValueToStruct fills the fields of output tagged with data:"TOKEN" using the model.
+// Values are converted to the type of each field; time.Time fields take a layout option,
+// e.g. data:"DOB,layout=02/01/2006". Fields that can't be converted are reported together
+// in a *DecodeError. The tag options required, default=, minconf= and regex= are checked
+// too, and the fields that fail them are reported in a *ValidationError. Nested structs are
+// filled from the same input, or from the section matched by their segment= option; a
+// []struct field gets one element per segment.
+//
+// It works like Unmarshal, scoring values with the extractor's Weights when the model has none.
+func (n TextExtractor) ParseValueToStruct(input string, output interface{}, model *Model) error {
+	return unmarshal(model, input, output, n.Weights)
+}
+
+// hasBefore reports whether the token has anything to anchor the start of its value.
+func (t TokenTrain) hasBefore() bool {
+	return t.WordBefore != "" || t.Lead != "" || t.BeforeBoundary != NoBoundary
 }
 
-func (n TextExtractor) ParseValueToStruct(input string, output interface{}, pathFile string) error {
-	tagsToFields := make(map[string]string)
-	t := reflect.TypeOf(output).Elem()
-	tokens, errLoad := n.Load(pathFile)
+// hasAfter reports whether the token has anything to anchor the end of its value.
+func (t TokenTrain) hasAfter() bool {
+	return t.WordAfter != "" || t.Trail != "" || t.AfterBoundary != NoBoundary
+}
 
-	if errLoad != nil {
-		return errLoad
+// beforePattern returns the regex that must precede the value.
+func (t TokenTrain) beforePattern() string {
+	if t.Lead == "" && t.LeadGap == 0 {
+		return boundaryPrefix(t.edge(t.BeforeBoundary)) + anchorPattern(t.WordBefore, t.Context)
 	}
 
-	// Mapeia tags para campos
-	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
-		tag := field.Tag.Get("data")
-		if tag != "" {
-			tagsToFields[tag] = field.Name
-		}
+	return boundaryPrefix(t.edge(t.BeforeBoundary)) + anchorPattern(t.Lead, t.Context) +
+		leadGapPattern(t.LeadGap, t.WordBefore != "") + anchorPattern(t.WordBefore, t.Context)
+}
+
+// afterPattern returns the regex that must follow the value.
+func (t TokenTrain) afterPattern() string {
+	if t.Trail == "" && t.TrailGap == 0 {
+		return anchorPattern(t.WordAfter, t.Context) + boundarySuffix(t.edge(t.AfterBoundary))
 	}
 
-	valueMap := make(map[string]Extracted)
+	return anchorPattern(t.WordAfter, t.Context) + trailGapPattern(t.TrailGap, t.WordAfter != "") +
+		anchorPattern(t.Trail, t.Context) + boundarySuffix(t.edge(t.AfterBoundary))
+}
 
-	for _, token := range tokens {
-		train := TokenTrain{
-			Name:       token.Name,
-			WordBefore: strings.Trim(token.WordBefore, "{}"),
-			WordAfter:  strings.Trim(token.WordAfter, "{}"),
-		}
+// edge returns the boundary the token is anchored to. Repeated values are found on
+// several lines, so they are never tied to the edges of the whole text.
+func (t TokenTrain) edge(b Boundary) Boundary {
+	if t.Repeated && b == TextBoundary {
+		return LineBoundary
+	}
 
-		extracted, have := n.GetValueBetweenTokens(input, train, n.Weights)
-		if have {
-			fieldName, tagExists := tagsToFields[extracted.Token]
-			if tagExists {
-				existingValue, found := valueMap[fieldName]
-				if !found || extracted.Precision > existingValue.Precision {
-					valueMap[fieldName] = extracted
-				}
-			}
-		}
+	return b
+}
+
+// finishValue trims, checks and filters a raw captured value.
+func finishValue(model TokenTrain, raw string) (string, bool) {
+	result := strings.TrimSpace(raw)
+	if result == "" || !validType(model.Type, result) {
+		return "", false
 	}
 
-	// Preenche a estrutura de saída usando os valores do mapa
-	outputValue := reflect.ValueOf(output).Elem()
-	for fieldName, extracted := range valueMap {
-		field := outputValue.FieldByName(fieldName)
-		if field.IsValid() && field.CanSet() {
-			field.SetString(extracted.Value)
+	result, err := applyFilters(result, model.Filters)
+	if err != nil {
+		return "", false
+	}
+
+	return result, true
+}
+
+// dataTagName returns the token name a struct field is filled from.
+func dataTagName(field reflect.StructField) string {
+	return parseDataTag(field).Name
+}
+
+// allOptional reports whether every token of the model is optional.
+func allOptional(matchers []*tokenMatcher) bool {
+	for _, m := range matchers {
+		if !m.token.Optional {
+			return false
 		}
 	}
 
-	return nil
+	return true
+}
+
+// scored reports whether every weight is set; otherwise every precision is 0.
+func (w PrecisionWeights) scored() bool {
+	return w.WordLengthWeight != 0 && w.TokenLengthWeight != 0 && w.CharacterCountWeight != 0
 }
 
-// calculatePrecision calculates precision of the extracted value.
+// calculatePrecision calculates precision of the extracted value: the weighted mean of the
+// value's length and the token name's length, so it grows with them and is not capped at 1.
 func calculatePrecision(value string, tokenLength, characterCount, tokenCount int, weights PrecisionWeights) float64 {
 	// Garantir que os pesos não sejam zero
-	if weights.WordLengthWeight == 0 || weights.TokenLengthWeight == 0 || weights.CharacterCountWeight == 0 {
+	if !weights.scored() {
 		return 0
 	}
 
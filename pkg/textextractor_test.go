@@ -1,10 +1,21 @@
 package textextractor_test
 
 import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"math"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
+	"testing/fstest"
+	"time"
 
 	textextractor "github.com/devalexandre/textextractor/pkg"
 
@@ -23,13 +34,16 @@ func TestSave(t *testing.T) {
 			"play {MUSIC} now",
 		}
 
-		ln := p.Learn(dataTrain)
+		ln, err := p.Learn(dataTrain)
+		if err != nil {
+			t.Fatalf("got %v want %v", err, nil)
+		}
 
 		if len(ln) <= 4 {
 			t.Errorf("got %v want %v", len(ln), 10)
 		}
 
-		err := p.Save(ln, "tokens")
+		err = p.Save(p.NewModel("tokens", ln), "tokens")
 		if err != nil {
 			t.Errorf("got %v want %v", err, nil)
 		}
@@ -52,8 +66,11 @@ func TestLoad(t *testing.T) {
 		if err != nil {
 			t.Errorf("got %v want %v", err, nil)
 		}
-		if len(model) <= 4 {
-			t.Errorf("got %v want %v", len(model), 10)
+		if len(model.Tokens) <= 4 {
+			t.Errorf("got %v want %v", len(model.Tokens), 10)
+		}
+		if model.Name != "tokens" || model.Precision != p.Precision {
+			t.Errorf("got %v %v want %v %v", model.Name, model.Precision, "tokens", p.Precision)
 		}
 	})
 }
@@ -107,13 +124,16 @@ func TestLearnSaveLoad(t *testing.T) {
 	trainingData := []string{"Play {Song}"}
 
 	// Test Learn
-	learnedTokens := extractor.Learn(trainingData)
+	learnedTokens, err := extractor.Learn(trainingData)
+	if err != nil {
+		t.Fatalf("Learn() error = %v", err)
+	}
 	if len(learnedTokens) == 0 {
 		t.Errorf("Learn() = %v, want at least one token", len(learnedTokens))
 	}
 
 	// Test Save
-	err := extractor.Save(learnedTokens, "test_tokens")
+	err = extractor.Save(extractor.NewModel("test_tokens", learnedTokens), "test_tokens")
 	if err != nil {
 		t.Errorf("Save() error = %v", err)
 	}
@@ -123,8 +143,8 @@ func TestLearnSaveLoad(t *testing.T) {
 	if err != nil {
 		t.Errorf("Load() error = %v", err)
 	}
-	if len(loadedTokens) == 0 {
-		t.Errorf("Load() = %v, want at least one token", len(loadedTokens))
+	if len(loadedTokens.Tokens) == 0 {
+		t.Errorf("Load() = %v, want at least one token", len(loadedTokens.Tokens))
 	}
 
 	// Cleanup
@@ -189,13 +209,16 @@ func TestLearn(t *testing.T) {
 			Title: {TITLE} DOB: {DOB}. POB: {POB} Good quality a.k.a:{AKA}  Nationality: Afghanistan Position: Deputy Minister of Defence under the Taliban regime Other Information: (UK Sanctions List Ref):AFG0024. (UN Ref):TAi.024. Arrested in Feb. 2010 and in custody in Pakistan. Extradition request to Afghanistan pending in Lahore High Court, Pakistan as of June 2011. Belongs to Popalzai tribe. Senior Taliban military commander and member of Taliban Quetta Council as of May 2007. Review pursuant to Security Council resolution 1822 (2008) was concluded on 1 Jun. 2010. INTERPOL-UN Security Council Special Notice web link: https://www.interpol.int/en/How-we-work/Notices/View-UN-Notices-Individuals click here Listed on: 02/04/2001 UK Sanctions List Date Designated: 23/02/2001 Last Updated: 01/02/2021 Group ID: 7060.`,
 		}
 
-		ln := p.Learn(dataTrain)
+		ln, err := p.Learn(dataTrain)
+		if err != nil {
+			t.Fatalf("got %v want %v", err, nil)
+		}
 
 		if len(ln) <= 10 {
 			t.Errorf("got %v want %v", len(ln), 10)
 		}
 
-		err := p.Save(ln, "tokens_names")
+		err = p.Save(p.NewModel("tokens_names", ln), "tokens_names")
 		if err != nil {
 			t.Errorf("got %v want %v", err, nil)
 		}
@@ -217,8 +240,13 @@ func TestParseValueToStruct(t *testing.T) {
 			Name string `data:"NAME"`
 			DOB  string `data:"DOB"`
 		}
+		model, err := p.Load("tokens_names")
+		if err != nil {
+			t.Fatalf("got %v want %v", err, nil)
+		}
+
 		person := Person{}
-		err := p.ParseValueToStruct(input, &person, "tokens_names")
+		err = p.ParseValueToStruct(input, &person, model)
 
 		if err != nil {
 			t.Errorf("got %v want %v", err, true)
@@ -273,6 +301,12 @@ func TestLoadError(t *testing.T) {
 	if err == nil {
 		t.Errorf("Load() with non-existent file, want error")
 	}
+
+	dir, _ := extractor.GetModelsDir()
+	var fileErr *textextractor.ModelFileError
+	if !errors.As(err, &fileErr) || fileErr.File != filepath.Join(dir, "non_existent_file.gob") || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Load() error = %v, want the missing file in the models directory", err)
+	}
 }
 
 func TestParseValueToStructError(t *testing.T) {
@@ -285,8 +319,1795 @@ func TestParseValueToStructError(t *testing.T) {
 	}
 	var person Person
 
-	err := extractor.ParseValueToStruct(input, &person, "non_existent_model")
+	model, _ := extractor.Load("non_existent_model")
+	err := extractor.ParseValueToStruct(input, &person, model)
 	if err == nil {
 		t.Errorf("ParseValueToStruct() with non-existent model file, want error")
 	}
 }
+
+func TestExtractPlaceholders(t *testing.T) {
+	extractor := textextractor.NewTextExtractor()
+	input := "Total: {Total:money} DOB: {DOB:date} Name: {Name}"
+	want := []textextractor.Placeholder{
+		{Name: "Total", Type: "money", Raw: "{Total:money}", Pos: textextractor.Position{Line: 1, Column: 8, Offset: 7}},
+		{Name: "DOB", Type: "date", Raw: "{DOB:date}", Pos: textextractor.Position{Line: 1, Column: 27, Offset: 26}},
+		{Name: "Name", Type: "", Raw: "{Name}", Pos: textextractor.Position{Line: 1, Column: 44, Offset: 43}},
+	}
+
+	got := extractor.ExtractPlaceholders(input)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ExtractPlaceholders() = %v, want %v", got, want)
+	}
+
+	if tokens := extractor.ExtractTokens(input); !reflect.DeepEqual(tokens, []string{"Total", "DOB", "Name"}) {
+		t.Errorf("ExtractTokens() = %v, want names without types", tokens)
+	}
+}
+
+func TestTypedPlaceholders(t *testing.T) {
+	extractor := textextractor.NewTextExtractor()
+	model, err := extractor.Learn([]string{"DOB: {DOB:date}. POB: {POB}"})
+	if err != nil {
+		t.Fatalf("Learn() error = %v", err)
+	}
+	if model[0].Type != "date" {
+		t.Fatalf("Learn() type = %q, want %q", model[0].Type, "date")
+	}
+
+	tests := []struct {
+		input string
+		want  string
+		have  bool
+	}{
+		{input: "DOB: 04/10/2011. POB: Kabul", want: "04/10/2011", have: true},
+		{input: "DOB: --/--/1969. POB: Kabul", have: false},
+	}
+
+	for _, tt := range tests {
+		got, have := extractor.GetValueBetweenTokens(tt.input, model[0], extractor.Weights)
+		if have != tt.have || got.Value != tt.want {
+			t.Errorf("GetValueBetweenTokens(%q) = %q, %v, want %q, %v", tt.input, got.Value, have, tt.want, tt.have)
+		}
+	}
+
+	t.Run("money with spaces", func(t *testing.T) {
+		train := textextractor.TokenTrain{Name: "Total", Type: "money", WordBefore: "Total:", WordAfter: " paid"}
+		got, have := extractor.GetValueBetweenTokens("Total: R$ 1.234,56 paid", train, extractor.Weights)
+		if !have || got.Value != "R$ 1.234,56" {
+			t.Errorf("got %q, %v want %q", got.Value, have, "R$ 1.234,56")
+		}
+	})
+
+	t.Run("typed regex", func(t *testing.T) {
+		got := extractor.GenerateRegex([]string{"DOB:date", "Name"})
+		if got[1] != `(?P<Name>[^\s]+)` || !strings.HasPrefix(got[0], `(?P<DOB>`) {
+			t.Errorf("GenerateRegex() = %v", got)
+		}
+	})
+}
+
+func TestParseTemplate(t *testing.T) {
+	t.Run("literals and placeholders", func(t *testing.T) {
+		tpl, err := textextractor.ParseTemplate(`Set \{x\} to {Value:int}.`)
+		if err != nil {
+			t.Fatalf("ParseTemplate() error = %v", err)
+		}
+
+		if len(tpl.Nodes) != 3 {
+			t.Fatalf("ParseTemplate() nodes = %d, want 3", len(tpl.Nodes))
+		}
+
+		literal, ok := tpl.Nodes[0].(*textextractor.Literal)
+		if !ok || literal.Text != "Set {x} to " {
+			t.Errorf("first node = %#v, want literal %q", tpl.Nodes[0], "Set {x} to ")
+		}
+
+		placeholder, ok := tpl.Nodes[1].(*textextractor.Placeholder)
+		if !ok || placeholder.Name != "Value" || placeholder.Type != "int" {
+			t.Errorf("second node = %#v, want placeholder Value:int", tpl.Nodes[1])
+		}
+	})
+
+	t.Run("syntax errors", func(t *testing.T) {
+		tests := []struct {
+			input  string
+			line   int
+			column int
+		}{
+			{input: "Name: {Name", line: 1, column: 7},
+			{input: "Name: {a{b}", line: 1, column: 9},
+			{input: "Name:\n{Name}}", line: 2, column: 7},
+			{input: "DOB: {DOB:when}", line: 1, column: 11},
+			{input: "Name: {}", line: 1, column: 7},
+		}
+
+		for _, tt := range tests {
+			_, err := textextractor.ParseTemplate(strings.ReplaceAll(tt.input, `\n`, "\n"))
+			var syntaxErr *textextractor.SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Errorf("ParseTemplate(%q) error = %v, want *SyntaxError", tt.input, err)
+				continue
+			}
+			if syntaxErr.Line != tt.line || syntaxErr.Column != tt.column {
+				t.Errorf("ParseTemplate(%q) error at %d:%d, want %d:%d", tt.input, syntaxErr.Line, syntaxErr.Column, tt.line, tt.column)
+			}
+		}
+	})
+
+	t.Run("learn fails on malformed templates", func(t *testing.T) {
+		extractor := textextractor.NewTextExtractor()
+		tokens, err := extractor.Learn([]string{"play {MUSIC}", "play {MUSIC"})
+		if err == nil || tokens != nil {
+			t.Errorf("Learn() = %v, %v, want error", tokens, err)
+		}
+	})
+}
+
+func TestOptionalAndRepeatedTokens(t *testing.T) {
+	extractor := textextractor.NewTextExtractor()
+	model, err := extractor.Learn([]string{
+		"Phone: {Phone:phone*}\n",
+		"a.k.a: {AKA?}.",
+	})
+	if err != nil {
+		t.Fatalf("Learn() error = %v", err)
+	}
+
+	if !model[0].Repeated || !model[1].Optional {
+		t.Fatalf("Learn() = %+v, want repeated Phone and optional AKA", model)
+	}
+
+	input := "Phone: +55 11 4004-0001\nPhone: +55 11 4004-0002\nName: John"
+
+	t.Run("repeated values", func(t *testing.T) {
+		got, have := extractor.GetValue(input, extractor.NewModel("phones", model[:1]))
+		want := []string{"+55 11 4004-0001", "+55 11 4004-0002"}
+		if !have || !reflect.DeepEqual(got.Values, want) {
+			t.Errorf("GetValue() = %v, %v want %v", got.Values, have, want)
+		}
+	})
+
+	t.Run("list of values", func(t *testing.T) {
+		tokens, err := extractor.Learn([]string{"Phones: {Phone:phone*} end"})
+		if err != nil {
+			t.Fatalf("Learn() error = %v", err)
+		}
+
+		input := "Phones: +55 11 99999-0000, +55 11 98888-1111 end"
+		want := []string{"+55 11 99999-0000", "+55 11 98888-1111"}
+		got, have := extractor.GetValue(input, extractor.NewModel("phones", tokens))
+		if !have || !reflect.DeepEqual(got.Values, want) {
+			t.Errorf("GetValue() = %v, %v want %v", got.Values, have, want)
+		}
+
+		matched, err := extractor.MatchTemplate("Phones: {Phone:phone*} end", input)
+		if err != nil || !reflect.DeepEqual(matched["Phone"].Values, want) {
+			t.Errorf("MatchTemplate() = %v, %v want %v", matched["Phone"].Values, err, want)
+		}
+	})
+
+	t.Run("missing optional", func(t *testing.T) {
+		got, have := extractor.GetValue(input, extractor.NewModel("aka", model[1:]))
+		if !have || got.Token != "AKA" || got.Value != "" {
+			t.Errorf("GetValue() = %+v, %v want empty AKA", got, have)
+		}
+	})
+
+	t.Run("parse into slice", func(t *testing.T) {
+		if err := extractor.Save(extractor.NewModel("test_phones", model), "test_phones"); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		defer os.Remove("models/test_phones.gob")
+
+		loaded, err := extractor.Load("test_phones")
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+
+		type Contact struct {
+			Phones []string `data:"Phone"`
+			AKA    string   `data:"AKA"`
+		}
+
+		var contact Contact
+		if err := extractor.ParseValueToStruct(input, &contact, loaded); err != nil {
+			t.Fatalf("ParseValueToStruct() error = %v", err)
+		}
+
+		if len(contact.Phones) != 2 || contact.AKA != "" {
+			t.Errorf("ParseValueToStruct() = %+v", contact)
+		}
+	})
+}
+
+func TestFilters(t *testing.T) {
+	textextractor.RegisterFilter("initials", func(value string, _ ...string) (string, error) {
+		var initials string
+		for _, word := range strings.Fields(value) {
+			initials += word[:1]
+		}
+		return initials, nil
+	})
+	t.Cleanup(func() { textextractor.UnregisterFilter("initials") })
+
+	extractor := textextractor.NewTextExtractor()
+	model, err := extractor.Learn([]string{
+		"Name: {Name|collapse|upper}. Age:",
+		"Total: {Total:money|replace:\"R$\":\"\"|trim}\n",
+		"Code: {Code|digits}\n",
+		"Name: {Initials|initials}. Age:",
+	})
+	if err != nil {
+		t.Fatalf("Learn() error = %v", err)
+	}
+
+	input := "Name: john   doe. Age: 30\nTotal: R$ 1.234,56\nCode: AB-12-34\n"
+	want := map[string]string{
+		"Name":     "JOHN DOE",
+		"Total":    "1.234,56",
+		"Code":     "1234",
+		"Initials": "jd",
+	}
+
+	for _, token := range model {
+		got, have := extractor.GetValueBetweenTokens(input, token, extractor.Weights)
+		if !have || got.Value != want[token.Name] {
+			t.Errorf("%s: got %q, %v want %q", token.Name, got.Value, have, want[token.Name])
+		}
+	}
+
+	t.Run("filter registered after load", func(t *testing.T) {
+		textextractor.RegisterFilter("shout", func(value string, _ ...string) (string, error) {
+			return strings.ToUpper(value) + "!", nil
+		})
+		tokens, err := extractor.Learn([]string{"Name: {Name|shout}. Age:"})
+		if err != nil {
+			t.Fatalf("Learn() error = %v", err)
+		}
+		var buf bytes.Buffer
+		if err := textextractor.WriteModel(&buf, extractor.NewModel("shout", tokens), textextractor.FormatGob); err != nil {
+			t.Fatalf("WriteModel() error = %v", err)
+		}
+		textextractor.UnregisterFilter("shout")
+
+		if _, err := textextractor.ReadModel(&buf); !errors.Is(err, textextractor.ErrUnknownFilter) {
+			t.Errorf("ReadModel() error = %v, want ErrUnknownFilter", err)
+		}
+		if _, err := textextractor.ExtractAll(extractor.NewModel("shout", tokens), input); !errors.Is(err, textextractor.ErrUnknownFilter) {
+			t.Errorf("ExtractAll() error = %v, want ErrUnknownFilter", err)
+		}
+	})
+
+	t.Run("unknown filter", func(t *testing.T) {
+		_, err := extractor.Learn([]string{"Name: {Name|shout}"})
+		var syntaxErr *textextractor.SyntaxError
+		if !errors.As(err, &syntaxErr) || syntaxErr.Column != 13 {
+			t.Errorf("Learn() error = %v, want unknown filter at column 13", err)
+		}
+	})
+
+	t.Run("wrong argument count", func(t *testing.T) {
+		_, err := extractor.Learn([]string{`Total: {T|replace:"$"} end`})
+		var syntaxErr *textextractor.SyntaxError
+		if !errors.As(err, &syntaxErr) || !strings.Contains(syntaxErr.Msg, "want 2, got 1") {
+			t.Errorf("Learn() error = %v, want replace to take 2 arguments", err)
+		}
+
+		textextractor.RegisterFilterArgs("pad", func(value string, args ...string) (string, error) {
+			return args[0] + value, nil
+		}, 1, 1)
+		defer textextractor.UnregisterFilter("pad")
+		if _, err := extractor.Learn([]string{"Code: {Code|pad} end"}); !errors.As(err, &syntaxErr) {
+			t.Errorf("Learn() error = %v, want pad to take 1 argument", err)
+		}
+
+		// Modelos salvos antes da checagem falham ao extrair, em vez de não achar nada
+		token := textextractor.TokenTrain{Name: "T", WordBefore: "otal: ", WordAfter: " end",
+			Filters: []textextractor.Filter{{Name: "replace", Args: []string{"$"}}}}
+		if _, err := textextractor.ExtractAll(extractor.NewModel("totals", []textextractor.TokenTrain{token}), "Total: $5 end"); !errors.Is(err, textextractor.ErrFilterArgs) {
+			t.Errorf("ExtractAll() error = %v, want ErrFilterArgs", err)
+		}
+	})
+}
+
+func TestCompileTemplate(t *testing.T) {
+	extractor := textextractor.NewTextExtractor()
+	template := "Invoice {Number:int}\nCustomer: {Customer|upper}\nDate: {Date:date}\nPhones: {Phone:phone*}\nNote: {Note?}\nTotal: {Total:money}"
+
+	regex, err := extractor.CompileTemplate(template)
+	if err != nil {
+		t.Fatalf("CompileTemplate() error = %v", err)
+	}
+	if !strings.HasPrefix(regex.String(), `^`) || !strings.HasSuffix(regex.String(), `$`) {
+		t.Errorf("CompileTemplate() = %s, want an anchored regex", regex)
+	}
+
+	input := "Invoice 1042\nCustomer:  John Doe\nDate: 04/10/2011\nPhones: +55 11 4004-0001, +55 11 4004-0002\nNote: \nTotal: R$ 1.234,56\n"
+	got, err := extractor.MatchTemplate(template, input)
+	if err != nil {
+		t.Fatalf("MatchTemplate() error = %v", err)
+	}
+
+	want := map[string]string{
+		"Number":   "1042",
+		"Customer": "JOHN DOE",
+		"Date":     "04/10/2011",
+		"Phone":    "+55 11 4004-0001",
+		"Total":    "R$ 1.234,56",
+	}
+	if len(got) != len(want) {
+		t.Errorf("MatchTemplate() = %v, want %d values", got, len(want))
+	}
+	for token, value := range want {
+		if got[token].Value != value {
+			t.Errorf("%s: got %q want %q", token, got[token].Value, value)
+		}
+	}
+	if len(got["Phone"].Values) != 2 {
+		t.Errorf("Phone values = %v, want 2", got["Phone"].Values)
+	}
+
+	t.Run("no match", func(t *testing.T) {
+		_, err := extractor.MatchTemplate(template, strings.Replace(input, "04/10/2011", "--/--/1969", 1))
+		if !errors.Is(err, textextractor.ErrNoMatch) {
+			t.Errorf("MatchTemplate() error = %v, want ErrNoMatch", err)
+		}
+	})
+
+	t.Run("empty optional", func(t *testing.T) {
+		got, err := extractor.MatchTemplate("a.k.a: {AKA?}. DOB: {DOB:date}", "a.k.a:. DOB: 01/02/2000")
+		if err != nil {
+			t.Fatalf("MatchTemplate() error = %v", err)
+		}
+		if _, found := got["AKA"]; found || got["DOB"].Value != "01/02/2000" {
+			t.Errorf("MatchTemplate() = %v, want only DOB", got)
+		}
+	})
+
+	t.Run("duplicate placeholder", func(t *testing.T) {
+		_, err := extractor.CompileTemplate("Name: {Name}. Alias: {Name}")
+		var syntaxErr *textextractor.SyntaxError
+		if !errors.As(err, &syntaxErr) || syntaxErr.Column != 22 {
+			t.Errorf("CompileTemplate() error = %v, want a duplicate placeholder at column 22", err)
+		}
+	})
+}
+
+func TestWordContext(t *testing.T) {
+	extractor := textextractor.NewTextExtractor()
+	extractor.Context = textextractor.WordContext
+	extractor.Precision = 3
+	input := "Name 6: {Name}. Name (non-Latin script): {NameNonLatin}\nDOB: --/--/1969. POB: {POB}"
+
+	t.Run("whole words", func(t *testing.T) {
+		tests := []struct {
+			token  string
+			before string
+			after  string
+		}{
+			{token: "{Name}", before: "Name 6: ", after: "."},
+			{token: "{NameNonLatin}", before: "Name (non-Latin script): ", after: ""},
+			{token: "{POB}", before: "POB: ", after: ""},
+		}
+
+		for _, tt := range tests {
+			if got := extractor.GetBeforeToken(input, tt.token); got != tt.before {
+				t.Errorf("GetBeforeToken(%s) = %q, want %q", tt.token, got, tt.before)
+			}
+			if got := extractor.GetAfterToken(input, tt.token); got != tt.after {
+				t.Errorf("GetAfterToken(%s) = %q, want %q", tt.token, got, tt.after)
+			}
+		}
+	})
+
+	t.Run("tolerates spacing changes", func(t *testing.T) {
+		model, err := extractor.Learn([]string{"Name 6: {Name}. Brazil"})
+		if err != nil {
+			t.Fatalf("Learn() error = %v", err)
+		}
+		if model[0].Context != textextractor.WordContext {
+			t.Errorf("Learn() context = %v, want WordContext", model[0].Context)
+		}
+
+		got, have := extractor.GetValueBetweenTokens("Name   6:  ABBASIN. Brazil", model[0], extractor.Weights)
+		if !have || got.Value != "ABBASIN" {
+			t.Errorf("GetValueBetweenTokens() = %q, %v want %q", got.Value, have, "ABBASIN")
+		}
+	})
+}
+
+func TestNeighbourAnchors(t *testing.T) {
+	extractor := textextractor.NewTextExtractor()
+	model, err := extractor.Learn([]string{"Name 6: {Name}. DOB: {DOB}. Name: {First} {Last}, aged"})
+	if err != nil {
+		t.Fatalf("Learn() error = %v", err)
+	}
+
+	want := []textextractor.TokenTrain{
+		{Name: "Name", WordBefore: "e 6: ", WordAfter: ". DOB", TextBefore: "Name 6: ", Next: "DOB"},
+		{Name: "DOB", WordBefore: "DOB: ", WordAfter: ". Nam", Prev: "Name", Next: "First"},
+		{Name: "First", WordBefore: "ame: ", WordAfter: " ", Prev: "DOB", Next: "Last"},
+		{Name: "Last", WordBefore: " ", WordAfter: ", age", TextAfter: ", aged", Prev: "First"},
+	}
+	if !reflect.DeepEqual(model, want) {
+		t.Errorf("Learn() = %+v, want %+v", model, want)
+	}
+
+	for _, token := range model {
+		if strings.ContainsAny(token.WordBefore+token.WordAfter, "{}") {
+			t.Errorf("%s: anchors %q %q run into a placeholder", token.Name, token.WordBefore, token.WordAfter)
+		}
+	}
+
+	first, last, have := extractor.GetAdjacentValues("Name 6: X. DOB: Y. Name: John Doe, aged 30", model[2], model[3], extractor.Weights)
+	if !have || first.Value != "John" || last.Value != "Doe" {
+		t.Errorf("GetAdjacentValues() = %q %q %v, want John Doe", first.Value, last.Value, have)
+	}
+}
+
+func TestTextAndLineBoundaries(t *testing.T) {
+	extractor := textextractor.NewTextExtractor()
+	model, err := extractor.Learn([]string{
+		"{USER} wrote:",
+		"Total {AMOUNT}",
+		"Items: 3\nID {ID}\nNotes",
+	})
+	if err != nil {
+		t.Fatalf("Learn() error = %v", err)
+	}
+
+	tests := []struct {
+		before         string
+		beforeBoundary textextractor.Boundary
+		after          string
+		afterBoundary  textextractor.Boundary
+		input          string
+		want           string
+	}{
+		{
+			before: "", beforeBoundary: textextractor.LineBoundary, after: " wrot", afterBoundary: textextractor.NoBoundary,
+			input: "Hi all\nbob wrote: hi", want: "bob",
+		},
+		{
+			before: "otal ", beforeBoundary: textextractor.NoBoundary, after: "", afterBoundary: textextractor.LineBoundary,
+			input: "Invoice 7\nTotal 12.00\nThanks", want: "12.00",
+		},
+		{
+			before: "ID ", beforeBoundary: textextractor.LineBoundary, after: "", afterBoundary: textextractor.LineBoundary,
+			input: "Items: 2\nPID 7\nID 42\nNotes", want: "42",
+		},
+	}
+
+	for i, tt := range tests {
+		token := model[i]
+		if token.WordBefore != tt.before || token.BeforeBoundary != tt.beforeBoundary ||
+			token.WordAfter != tt.after || token.AfterBoundary != tt.afterBoundary {
+			t.Errorf("%s: Learn() = %+v", token.Name, token)
+		}
+
+		got, have := extractor.GetValueBetweenTokens(tt.input, token, extractor.Weights)
+		if !have || got.Value != tt.want {
+			t.Errorf("%s: GetValueBetweenTokens() = %q, %v want %q", token.Name, got.Value, have, tt.want)
+		}
+	}
+}
+
+func TestTemplateEdgesAreLineEdges(t *testing.T) {
+	extractor := textextractor.NewTextExtractor()
+
+	t.Run("value in the middle of a line", func(t *testing.T) {
+		tokens, err := extractor.Learn([]string{"Play {Song}"})
+		if err != nil {
+			t.Fatalf("Learn() error = %v", err)
+		}
+
+		// A âncora com Precision caracteres não é presa ao começo da linha
+		if tokens[0].BeforeBoundary != textextractor.NoBoundary {
+			t.Errorf("BeforeBoundary = %v, want none for a full anchor", tokens[0].BeforeBoundary)
+		}
+		got, have := extractor.GetValueBetweenTokens("Please Play Thriller now", tokens[0], extractor.Weights)
+		if !have || got.Value != "Thriller now" {
+			t.Errorf("GetValueBetweenTokens() = %q, %v want %q", got.Value, have, "Thriller now")
+		}
+	})
+
+	t.Run("repeated values", func(t *testing.T) {
+		tests := []struct {
+			template string
+			input    string
+			want     []string
+		}{
+			{"AKA: {AKA*}\n", "AKA: Bob\nAKA: Rob\nAKA: Bobby\n", []string{"Bob", "Rob", "Bobby"}},
+			{"Phone: {Phone:phone*}", "Phone: 555-0101\nPhone: 555-0102\nPhone: 555-0103", []string{"555-0101", "555-0102", "555-0103"}},
+		}
+
+		for _, tt := range tests {
+			tokens, err := extractor.Learn([]string{tt.template})
+			if err != nil {
+				t.Fatalf("Learn() error = %v", err)
+			}
+
+			got, have := extractor.GetValue(tt.input, extractor.NewModel("repeated", tokens))
+			if !have || !reflect.DeepEqual(got.Values, tt.want) {
+				t.Errorf("%s: GetValue() = %v, %v want %v", tt.template, got.Values, have, tt.want)
+			}
+		}
+	})
+}
+
+func TestGeneralize(t *testing.T) {
+	extractor := textextractor.NewTextExtractor()
+	extractor.Context = textextractor.WordContext
+	extractor.Precision = 2
+	tokens, err := extractor.Learn([]string{
+		"Name 6: {Name}. Brazil",
+		"Name 7: {Name}. Brazil",
+		"Name 6: {Name}. Chile",
+		"play {MUSIC} now",
+	})
+	if err != nil {
+		t.Fatalf("Learn() error = %v", err)
+	}
+
+	model := extractor.Generalize(tokens)
+	if len(model) != 2 {
+		t.Fatalf("Generalize() = %d tokens, want 2", len(model))
+	}
+
+	name := model[0]
+	if name.Support != 3 || len(name.Alternatives) != 2 {
+		t.Fatalf("Generalize() = %+v, want 3 examples in 2 alternatives", name)
+	}
+	if name.Alternatives[0].WordBefore != "Name 6: " || name.Alternatives[0].Support != 2 {
+		t.Errorf("first alternative = %+v, want the most supported one", name.Alternatives[0])
+	}
+	if name.WordBefore != ": " || name.WordAfter != ". " {
+		t.Errorf("common anchors = %q %q, want %q %q", name.WordBefore, name.WordAfter, ": ", ". ")
+	}
+	if name.Lead != "Name " || name.LeadGap != 1 {
+		t.Errorf("lead = %q with %d words, want %q with 1", name.Lead, name.LeadGap, "Name ")
+	}
+
+	t.Run("matches an unseen variant", func(t *testing.T) {
+		got, have := extractor.GetValue("Name 8: ABBASIN. Peru", extractor.NewModel("names", model))
+		if !have || got.Value != "ABBASIN" {
+			t.Errorf("GetValue() = %q, %v want %q", got.Value, have, "ABBASIN")
+		}
+	})
+
+	if model[1].Support != 1 || model[1].Alternatives != nil {
+		t.Errorf("single example token = %+v, want it unchanged", model[1])
+	}
+}
+
+func TestGeneralizeAlignsLines(t *testing.T) {
+	extractor := textextractor.NewTextExtractor()
+	tokens, err := extractor.Learn([]string{"play to {MUSIC}", "play the {MUSIC}", "play {MUSIC}"})
+	if err != nil {
+		t.Fatalf("Learn() error = %v", err)
+	}
+
+	music := extractor.Generalize(tokens)[0]
+	if music.Lead != "play " || music.LeadGap != 1 {
+		t.Errorf("lead = %q with %d words, want %q with 1", music.Lead, music.LeadGap, "play ")
+	}
+	if music.AfterBoundary != textextractor.LineBoundary {
+		t.Errorf("AfterBoundary = %v, want the boundary every example shares", music.AfterBoundary)
+	}
+
+	model := extractor.NewModel("music", []textextractor.TokenTrain{music})
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"play despacito", "despacito"},
+		{"play the despacito", "despacito"},
+		{"play rolling stones", "rolling stones"},
+		{"play despacito remix", "despacito remix"},
+		{"play the rolling stones", "rolling stones"},
+		{"play tunes loudly", "tunes loudly"},
+	}
+	for _, tt := range tests {
+		got, _ := extractor.GetValue(tt.input, model)
+		if got.Value != tt.want {
+			t.Errorf("GetValue(%q) = %q, want %q", tt.input, got.Value, tt.want)
+		}
+	}
+
+	t.Run("unseen variant", func(t *testing.T) {
+		tokens, err := extractor.Learn([]string{"play to {MUSIC}", "play the {MUSIC}"})
+		if err != nil {
+			t.Fatalf("Learn() error = %v", err)
+		}
+
+		// O começo comum para em uma palavra inteira, não em "play t"
+		music := extractor.Generalize(tokens)[0]
+		if music.Lead != "play " {
+			t.Errorf("lead = %q, want %q", music.Lead, "play ")
+		}
+
+		model := extractor.NewModel("music", []textextractor.TokenTrain{music})
+		for input, want := range map[string]string{"play a despacito": "despacito", "play to rolling stones": "rolling stones"} {
+			if got, _ := extractor.GetValue(input, model); got.Value != want {
+				t.Errorf("GetValue(%q) = %q, want %q", input, got.Value, want)
+			}
+		}
+	})
+}
+
+func TestLearnFromExamples(t *testing.T) {
+	extractor := textextractor.NewTextExtractor()
+	examples := []textextractor.LabeledExample{
+		{
+			Text:   "Name 6: ABBASIN. DOB: 04/10/2011. POB: Kabul",
+			Values: map[string]string{"NAME": "ABBASIN", "DOB": "04/10/2011", "POB": "Kabul"},
+		},
+		{
+			Text:   "Name 6: KABUL. DOB: --/--/1969. POB: Kabul, Kabul",
+			Values: map[string]string{"NAME": "KABUL", "POB": "Kabul", "GROUP": "12156"},
+		},
+	}
+
+	tokens, err := extractor.LearnFromExamples(examples)
+
+	var exampleErr *textextractor.ExampleError
+	if !errors.As(err, &exampleErr) || len(exampleErr.Issues) != 2 {
+		t.Fatalf("LearnFromExamples() error = %v, want 2 issues", err)
+	}
+	if !errors.Is(err, textextractor.ErrValueNotFound) || !errors.Is(err, textextractor.ErrValueAmbiguous) {
+		t.Errorf("LearnFromExamples() error = %v, want not found and ambiguous values", err)
+	}
+
+	templateTokens, _ := extractor.Learn([]string{"Name 6: {NAME}. DOB: {DOB}. POB: {POB}"})
+	for _, want := range templateTokens {
+		found := false
+		for _, got := range tokens {
+			if reflect.DeepEqual(got, want) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("LearnFromExamples() = %+v, want it to contain %+v", tokens, want)
+		}
+	}
+
+	if len(tokens) != 4 {
+		t.Errorf("LearnFromExamples() = %d tokens, want 4", len(tokens))
+	}
+}
+
+func TestLearnFromStruct(t *testing.T) {
+	type Person struct {
+		Name   string   `data:"NAME"`
+		DOB    string   `data:"DOB"`
+		Age    int      `data:"AGE"`
+		Phones []string `data:"PHONE"`
+		Notes  string
+	}
+
+	extractor := textextractor.NewTextExtractor()
+	input := "Name: ABBASIN. DOB: 04/10/2011. Age: 42 years\nPhone: 555-0101\nPhone: 555-0102\n"
+	person := Person{Name: "ABBASIN", DOB: "04/10/2011", Age: 42, Phones: []string{"555-0101", "555-0102"}}
+
+	tokens, err := extractor.LearnFromStruct(input, &person)
+	if err != nil {
+		t.Fatalf("LearnFromStruct() error = %v", err)
+	}
+	if len(tokens) != 4 {
+		t.Fatalf("LearnFromStruct() = %+v, want 4 tokens", tokens)
+	}
+
+	byName := map[string]textextractor.TokenTrain{}
+	for _, token := range tokens {
+		byName[token.Name] = token
+	}
+	if !byName["PHONE"].Repeated {
+		t.Errorf("PHONE token = %+v, want repeated", byName["PHONE"])
+	}
+
+	other := "Name: MAHSUD. DOB: 01/02/1970. Age: 51 years\nPhone: 555-0199\nPhone: 555-0198\n"
+	want := map[string]string{"NAME": "MAHSUD", "DOB": "01/02/1970", "AGE": "51", "PHONE": "555-0199"}
+	for name, value := range want {
+		got, have := extractor.GetValueBetweenTokens(other, byName[name], extractor.Weights)
+		if !have || got.Value != value {
+			t.Errorf("%s: got %q, %v want %q", name, got.Value, have, value)
+		}
+	}
+
+	if _, err := extractor.LearnFromStruct(input, "not a struct"); err == nil {
+		t.Errorf("LearnFromStruct() with a string, want error")
+	}
+}
+
+func TestLearnWithNegatives(t *testing.T) {
+	extractor := textextractor.NewTextExtractor()
+
+	t.Run("lengthens anchors", func(t *testing.T) {
+		negatives := []textextractor.NegativeExample{{Token: "MUSIC", Text: "open display settings"}}
+		tokens, err := extractor.LearnWithNegatives([]string{"now play {MUSIC}"}, negatives)
+		if err != nil || len(tokens) != 1 {
+			t.Fatalf("LearnWithNegatives() = %+v, %v", tokens, err)
+		}
+
+		learned, _ := extractor.Learn([]string{"now play {MUSIC}"})
+		if len(tokens[0].WordBefore) <= len(learned[0].WordBefore) || len(tokens[0].Negatives) != 0 {
+			t.Errorf("WordBefore = %q, negatives %v, want an anchor longer than %q", tokens[0].WordBefore, tokens[0].Negatives, learned[0].WordBefore)
+		}
+		if _, have := extractor.GetValueBetweenTokens("open display settings", tokens[0], extractor.Weights); have {
+			t.Errorf("GetValueBetweenTokens() matched a counter-example")
+		}
+		if got, have := extractor.GetValueBetweenTokens("now play despacito", tokens[0], extractor.Weights); !have || got.Value != "despacito" {
+			t.Errorf("GetValueBetweenTokens() = %q, %v want %q", got.Value, have, "despacito")
+		}
+	})
+
+	t.Run("stops at the edge of the line", func(t *testing.T) {
+		negatives := []textextractor.NegativeExample{{Token: "MUSIC", Text: "open display settings"}}
+		tokens, err := extractor.LearnWithNegatives([]string{"play {MUSIC}"}, negatives)
+		if err != nil || len(tokens) != 1 {
+			t.Fatalf("LearnWithNegatives() = %+v, %v", tokens, err)
+		}
+
+		if tokens[0].BeforeBoundary != textextractor.LineBoundary || len(tokens[0].Negatives) != 0 {
+			t.Errorf("LearnWithNegatives() = %+v, want the anchor cut by the start of the line", tokens[0])
+		}
+		for _, input := range []string{"open display settings", "the display settings"} {
+			if got, have := extractor.GetValueBetweenTokens(input, tokens[0], extractor.Weights); have {
+				t.Errorf("GetValueBetweenTokens(%q) = %q, want no match", input, got.Value)
+			}
+		}
+		if got, have := extractor.GetValueBetweenTokens("play despacito", tokens[0], extractor.Weights); !have || got.Value != "despacito" {
+			t.Errorf("GetValueBetweenTokens() = %q, %v want %q", got.Value, have, "despacito")
+		}
+	})
+
+	t.Run("saves wrong spans", func(t *testing.T) {
+		negatives := []textextractor.NegativeExample{{Token: "NAME", Text: "Name: n/a", Value: "n/a"}}
+		tokens, err := extractor.LearnWithNegatives([]string{"Name: {NAME}"}, negatives)
+		if err != nil || len(tokens) != 1 || len(tokens[0].Negatives) != 1 {
+			t.Fatalf("LearnWithNegatives() = %+v, %v", tokens, err)
+		}
+
+		if _, have := extractor.GetValueBetweenTokens("Name: n/a", tokens[0], extractor.Weights); have {
+			t.Errorf("GetValueBetweenTokens() returned a rejected value")
+		}
+		if got, have := extractor.GetValueBetweenTokens("Name: ABBASIN", tokens[0], extractor.Weights); !have || got.Value != "ABBASIN" {
+			t.Errorf("GetValueBetweenTokens() = %q, %v want %q", got.Value, have, "ABBASIN")
+		}
+	})
+
+	t.Run("drops anchors it can't fix", func(t *testing.T) {
+		negatives := []textextractor.NegativeExample{{Token: "USER", Text: "nobody wrote:"}}
+		tokens, err := extractor.LearnWithNegatives([]string{"{USER} wrote:", "Hello {TO},"}, negatives)
+		if err != nil || len(tokens) != 1 || tokens[0].Name != "TO" {
+			t.Errorf("LearnWithNegatives() = %+v, %v want only TO", tokens, err)
+		}
+	})
+}
+
+func TestLearnInto(t *testing.T) {
+	extractor := textextractor.NewTextExtractor()
+	model := &textextractor.Model{}
+
+	if err := extractor.LearnInto(model, []string{"play {MUSIC}", "play the {MUSIC}"}); err != nil {
+		t.Fatalf("LearnInto() error = %v", err)
+	}
+	if err := extractor.LearnInto(model, []string{"play {MUSIC}", "play {MUSIC} now"}); err != nil {
+		t.Fatalf("LearnInto() error = %v", err)
+	}
+
+	if len(model.Tokens) != 3 {
+		t.Fatalf("LearnInto() = %d tokens, want 3 without duplicates", len(model.Tokens))
+	}
+	if model.Precision != extractor.Precision || model.Context != extractor.Context || model.Version != textextractor.ModelVersion || model.CreatedAt.IsZero() {
+		t.Errorf("LearnInto() = %+v, want the extractor's settings recorded", model)
+	}
+	if model.Tokens[0].Support != 2 || model.Tokens[1].Support != 1 {
+		t.Errorf("LearnInto() support = %d %d, want 2 1", model.Tokens[0].Support, model.Tokens[1].Support)
+	}
+	for _, token := range model.Tokens {
+		if token.LastSeen.IsZero() {
+			t.Errorf("%+v: want LastSeen to be set", token)
+		}
+	}
+
+	if err := extractor.LearnInto(model, []string{"play {MUSIC"}); err == nil {
+		t.Errorf("LearnInto() with a malformed template, want error")
+	}
+
+	t.Run("concurrent updates", func(t *testing.T) {
+		shared := &textextractor.Model{}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 20; i++ {
+				extractor.LearnInto(shared, []string{fmt.Sprintf("track %d: {MUSIC}", i)})
+			}
+		}()
+		for i := 0; i < 20; i++ {
+			extractor.GetValue("track 1: despacito", shared)
+		}
+		<-done
+	})
+
+	t.Run("generalized model", func(t *testing.T) {
+		generalized := &textextractor.Model{Tokens: extractor.Generalize(model.Tokens)}
+		tokens, _ := extractor.Learn([]string{"play to {MUSIC}", "play the {MUSIC}"})
+		generalized.Update(tokens)
+
+		if len(generalized.Tokens) != 1 {
+			t.Fatalf("Update() = %d tokens, want 1", len(generalized.Tokens))
+		}
+		token := generalized.Tokens[0]
+		if token.Support != 6 || len(token.Alternatives) != 4 || token.Alternatives[0].Support != 2 {
+			t.Errorf("Update() = %+v, want 6 examples in 4 alternatives", token)
+		}
+	})
+}
+
+func TestModel(t *testing.T) {
+	trainer := textextractor.NewTextExtractor()
+	trainer.Precision = 8
+	tokens, err := trainer.Learn([]string{"Name 6: {Name}. DOB: {DOB}.", "Nome 6: {Name}. DOB: {DOB}."})
+	if err != nil {
+		t.Fatalf("Learn() error = %v", err)
+	}
+
+	model := trainer.NewModel("people", tokens)
+	if model.Version != textextractor.ModelVersion || model.Precision != 8 || model.CreatedAt.IsZero() {
+		t.Errorf("NewModel() = %+v, want version, precision and creation time", model)
+	}
+	if stats := model.Stats["Name"]; stats.Examples != 2 || stats.Anchors != 2 {
+		t.Errorf("Stats[Name] = %+v, want 2 examples and 2 anchors", stats)
+	}
+
+	if err := trainer.Save(model, "test_model"); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	defer os.Remove("models/test_model.gob")
+
+	extractor := textextractor.NewTextExtractor()
+	loaded, err := extractor.Load("test_model")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if loaded.Precision != 8 {
+		t.Errorf("Load() precision = %d, want 8", loaded.Precision)
+	}
+
+	input := "Nome 6: ABBASIN. DOB: 04/10/2011."
+	want, _ := trainer.GetValue(input, model)
+	got, have := extractor.GetValue(input, loaded)
+	if !have || !reflect.DeepEqual(got, want) {
+		t.Errorf("GetValue() = %+v, want %+v", got, want)
+	}
+
+	t.Run("learns with the model precision", func(t *testing.T) {
+		if err := extractor.LearnInto(loaded, []string{"Name 7: {Name}. DOB: {DOB}."}); err != nil {
+			t.Fatalf("LearnInto() error = %v", err)
+		}
+		last := loaded.Tokens[len(loaded.Tokens)-1]
+		if last.WordBefore != "Name 7: " {
+			t.Errorf("LearnInto() anchor = %q, want %q", last.WordBefore, "Name 7: ")
+		}
+	})
+}
+
+func TestModelFileFormat(t *testing.T) {
+	extractor := textextractor.NewTextExtractor()
+	tokens, err := extractor.Learn([]string{"Name: {Name}. DOB: {DOB}."})
+	if err != nil {
+		t.Fatalf("Learn() error = %v", err)
+	}
+
+	dir, err := extractor.GetModelsDir()
+	if err != nil {
+		t.Fatalf("GetModelsDir() error = %v", err)
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("migrates headerless gob", func(t *testing.T) {
+		path := filepath.Join(dir, "test_legacy.gob")
+		file, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(path)
+		if err := gob.NewEncoder(file).Encode(tokens); err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+
+		model, err := extractor.Load("test_legacy")
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if model.Version != textextractor.ModelVersion || len(model.Tokens) != 2 {
+			t.Errorf("Load() = %+v, want the legacy tokens in a current model", model)
+		}
+	})
+
+	t.Run("corrupt file", func(t *testing.T) {
+		if err := extractor.Save(extractor.NewModel("test_corrupt", tokens), "test_corrupt"); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		path := filepath.Join(dir, "test_corrupt.gob")
+		defer os.Remove(path)
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for name, corrupt := range map[string][]byte{
+			"truncated": data[:len(data)-10],
+			"flipped":   append(append([]byte{}, data[:len(data)-1]...), data[len(data)-1]^0xff),
+		} {
+			if err := os.WriteFile(path, corrupt, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := extractor.Load("test_corrupt")
+			var fileErr *textextractor.ModelFileError
+			if !errors.Is(err, textextractor.ErrCorruptModel) || !errors.As(err, &fileErr) || fileErr.File != path {
+				t.Errorf("%s: Load() error = %v, want ErrCorruptModel naming %s", name, err, path)
+			}
+		}
+	})
+}
+
+func TestTextModelFormats(t *testing.T) {
+	extractor := textextractor.NewTextExtractor()
+	extractor.Context = textextractor.WordContext
+	tokens, err := extractor.Learn([]string{"Name: {Name|upper}.\nPhone: {Phone:phone*}\n"})
+	if err != nil {
+		t.Fatalf("Learn() error = %v", err)
+	}
+	model := extractor.NewModel("contacts", tokens)
+	input := "Name: abbasin.\nPhone: 555-0101\n"
+
+	for _, filename := range []string{"test_contacts.json", "test_contacts.yaml"} {
+		t.Run(filename, func(t *testing.T) {
+			if err := extractor.Save(model, filename); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+			defer os.Remove(filepath.Join("models", filename))
+
+			data, err := os.ReadFile(filepath.Join("models", filename))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(data), "wordBefore") || !strings.Contains(string(data), "word") {
+				t.Errorf("Save() = %s, want named fields and modes", data)
+			}
+
+			loaded, err := extractor.Load(filename)
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if loaded.Name != "contacts" {
+				t.Errorf("Load() name = %q", loaded.Name)
+			}
+			if !reflect.DeepEqual(loaded.Tokens[0].Filters, tokens[0].Filters) || loaded.Tokens[0].Context != textextractor.WordContext {
+				t.Errorf("Load() = %+v, want %+v", loaded.Tokens[0], tokens[0])
+			}
+
+			got, have := extractor.GetValue(input, loaded)
+			if !have || got.Value != "ABBASIN" {
+				t.Errorf("GetValue() = %q, %v want %q", got.Value, have, "ABBASIN")
+			}
+
+			// Salvar de novo o mesmo modelo gera o mesmo arquivo
+			if err := extractor.Save(loaded, filename); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+			again, _ := os.ReadFile(filepath.Join("models", filename))
+			if string(again) != string(data) {
+				t.Errorf("Save() after Load() =\n%s\nwant\n%s", again, data)
+			}
+		})
+	}
+}
+
+func TestTokenJSONOmitsEmptyFields(t *testing.T) {
+	extractor := textextractor.NewTextExtractor()
+	tokens, err := extractor.Learn([]string{"Name: {Name}."})
+	if err != nil {
+		t.Fatalf("Learn() error = %v", err)
+	}
+
+	data, err := json.Marshal(tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "lastSeen") || strings.Contains(string(data), `"context"`) {
+		t.Errorf("json.Marshal() = %s, want no zero lastSeen or default context", data)
+	}
+
+	model := &textextractor.Model{}
+	model.Update(tokens)
+	data, _ = json.Marshal(model.Tokens)
+	if !strings.Contains(string(data), "lastSeen") {
+		t.Errorf("json.Marshal() = %s, want lastSeen once merged into a model", data)
+	}
+
+	var decoded []textextractor.TokenTrain
+	if err := json.Unmarshal(data, &decoded); err != nil || !decoded[0].LastSeen.Equal(model.Tokens[0].LastSeen) {
+		t.Errorf("json.Unmarshal() = %+v, %v want LastSeen %v", decoded, err, model.Tokens[0].LastSeen)
+	}
+}
+
+func TestModelReadersAndWriters(t *testing.T) {
+	extractor := textextractor.NewTextExtractor()
+	tokens, err := extractor.Learn([]string{"Name: {Name}. DOB: {DOB:date}."})
+	if err != nil {
+		t.Fatalf("Learn() error = %v", err)
+	}
+	model := extractor.NewModel("people", tokens)
+	input := "Name: ABBASIN. DOB: 04/10/2011."
+
+	var buf bytes.Buffer
+	if err := textextractor.WriteModel(&buf, model, textextractor.FormatGob); err != nil {
+		t.Fatalf("WriteModel() error = %v", err)
+	}
+
+	var legacy bytes.Buffer
+	if err := gob.NewEncoder(&legacy).Encode(tokens); err != nil {
+		t.Fatal(err)
+	}
+
+	jsonModel, _ := json.Marshal(model)
+
+	for name, data := range map[string][]byte{
+		"gob":        buf.Bytes(),
+		"legacy gob": legacy.Bytes(),
+		"json":       jsonModel,
+	} {
+		loaded, err := textextractor.ReadModel(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("%s: ReadModel() error = %v", name, err)
+			continue
+		}
+		if got, have := extractor.GetValue(input, loaded); !have || got.Value != "ABBASIN" {
+			t.Errorf("%s: GetValue() = %q, %v want %q", name, got.Value, have, "ABBASIN")
+		}
+	}
+
+	t.Run("same encoding as Save", func(t *testing.T) {
+		saver := *extractor
+		saver.ModelsDir = t.TempDir()
+		for _, format := range []textextractor.Format{textextractor.FormatGob, textextractor.FormatJSON, textextractor.FormatYAML} {
+			if err := saver.Save(model, "people."+string(format)); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+			saved, _ := os.ReadFile(filepath.Join(saver.ModelsDir, "people."+string(format)))
+
+			var written bytes.Buffer
+			if err := textextractor.WriteModel(&written, model, format); err != nil {
+				t.Fatalf("WriteModel(%s) error = %v", format, err)
+			}
+
+			// O gob não ordena as chaves de Stats, então compara os modelos lidos
+			if format == textextractor.FormatGob {
+				fromSave, _ := textextractor.ReadModel(bytes.NewReader(saved))
+				fromWrite, err := textextractor.ReadModel(&written)
+				got, _ := json.Marshal(fromWrite)
+				want, _ := json.Marshal(fromSave)
+				if err != nil || !bytes.Equal(got, want) {
+					t.Errorf("WriteModel(gob) = %s, %v want the model Save wrote", got, err)
+				}
+				continue
+			}
+			if !bytes.Equal(written.Bytes(), saved) {
+				t.Errorf("WriteModel(%s) = %q, want the bytes Save wrote", format, written.Bytes())
+			}
+		}
+
+		if err := textextractor.WriteModel(io.Discard, model, "xml"); !errors.Is(err, textextractor.ErrUnsupportedModel) {
+			t.Errorf("WriteModel(xml) error = %v, want ErrUnsupportedModel", err)
+		}
+	})
+
+	t.Run("fs", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"models/people.gob":  {Data: buf.Bytes()},
+			"models/people.json": {Data: jsonModel},
+			"models/corrupt.gob": {Data: buf.Bytes()[:20]},
+		}
+
+		for _, name := range []string{"models/people", "models/people.json"} {
+			loaded, err := textextractor.LoadFS(fsys, name)
+			if err != nil {
+				t.Fatalf("LoadFS(%s) error = %v", name, err)
+			}
+			if loaded.Name != "people" || len(loaded.Tokens) != 2 {
+				t.Errorf("LoadFS(%s) = %+v", name, loaded)
+			}
+		}
+
+		_, err := textextractor.LoadFS(fsys, "models/corrupt")
+		var fileErr *textextractor.ModelFileError
+		if !errors.As(err, &fileErr) || fileErr.File != "models/corrupt.gob" {
+			t.Errorf("LoadFS() error = %v, want a ModelFileError naming models/corrupt.gob", err)
+		}
+
+		if _, err := textextractor.LoadFS(fsys, "models/missing"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("LoadFS() error = %v, want fs.ErrNotExist", err)
+		}
+	})
+}
+
+func TestAtomicSave(t *testing.T) {
+	extractor := textextractor.NewTextExtractor()
+	extractor.ModelsDir = t.TempDir()
+	extractor.Backup = true
+
+	first, _ := extractor.Learn([]string{"Name: {Name}."})
+	second, _ := extractor.Learn([]string{"Name: {Name}. DOB: {DOB}."})
+
+	if err := extractor.Save(extractor.NewModel("people", first), "people.json"); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := extractor.Save(extractor.NewModel("people", second), "people.json"); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	backup, err := extractor.Load("people.bak.json")
+	if err != nil || len(backup.Tokens) != 1 {
+		t.Errorf("Load(backup) = %v, %v want the previous model", backup, err)
+	}
+
+	t.Run("failed save keeps the model", func(t *testing.T) {
+		broken := extractor.NewModel("people", first)
+		broken.Weights.WordLengthWeight = math.NaN()
+		if err := extractor.Save(broken, "people.json"); err == nil {
+			t.Fatalf("Save() with an unencodable model, want error")
+		}
+
+		model, err := extractor.Load("people.json")
+		if err != nil || len(model.Tokens) != 2 {
+			t.Errorf("Load() = %v, %v want the last saved model", model, err)
+		}
+
+		entries, _ := os.ReadDir(extractor.ModelsDir)
+		if len(entries) != 2 {
+			t.Errorf("ModelsDir has %d files, want the model and its backup", len(entries))
+		}
+	})
+}
+
+func TestRegistry(t *testing.T) {
+	extractor := textextractor.NewTextExtractor()
+	extractor.ModelsDir = t.TempDir()
+
+	if _, err := extractor.List("people"); !errors.Is(err, textextractor.ErrNoRelease) {
+		t.Errorf("List() error = %v, want ErrNoRelease", err)
+	}
+
+	training := [][]string{
+		{"Name: {Name}."},
+		{"Name: {Name}. DOB: {DOB}."},
+	}
+	for i, input := range training {
+		tokens, err := extractor.Learn(input)
+		if err != nil {
+			t.Fatalf("Learn() error = %v", err)
+		}
+
+		release, err := extractor.Publish("people", extractor.NewModel("", tokens), textextractor.Release{
+			TrainingSet: textextractor.HashTrainingSet(input),
+			Scores:      map[string]float64{"accuracy": 0.9},
+		})
+		if err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+		if release.Version != i+1 {
+			t.Errorf("Publish() version = %d, want %d", release.Version, i+1)
+		}
+	}
+
+	loaded := func() int {
+		model, err := extractor.Load("people")
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		return len(model.Tokens)
+	}
+
+	if got := loaded(); got != 1 {
+		t.Errorf("Load() = %d tokens, want the first version still promoted", got)
+	}
+
+	if err := extractor.Promote("people", 2); err != nil {
+		t.Fatalf("Promote() error = %v", err)
+	}
+	if got := loaded(); got != 2 {
+		t.Errorf("Load() after Promote() = %d tokens, want 2", got)
+	}
+
+	releases, err := extractor.List("people")
+	if err != nil || len(releases) != 2 || !releases[1].Promoted || releases[0].TrainingSet == releases[1].TrainingSet {
+		t.Errorf("List() = %+v, %v", releases, err)
+	}
+
+	release, err := extractor.Rollback("people")
+	if err != nil || release.Version != 1 || loaded() != 1 {
+		t.Errorf("Rollback() = %+v, %v want version 1", release, err)
+	}
+	if _, err := extractor.Rollback("people"); !errors.Is(err, textextractor.ErrNoRollback) {
+		t.Errorf("Rollback() error = %v, want ErrNoRollback", err)
+	}
+	if err := extractor.Promote("people", 7); !errors.Is(err, textextractor.ErrNoRelease) {
+		t.Errorf("Promote() error = %v, want ErrNoRelease", err)
+	}
+
+	t.Run("keeps the caller's model", func(t *testing.T) {
+		tokens, _ := extractor.Learn([]string{"Name: {Name}."})
+		model := extractor.NewModel("", tokens)
+		if _, err := extractor.Publish("people", model, textextractor.Release{}); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+		if model.Name != "" {
+			t.Errorf("Publish() renamed the model to %q", model.Name)
+		}
+	})
+
+	t.Run("concurrent publishes", func(t *testing.T) {
+		tokens, _ := extractor.Learn([]string{"Name: {Name}."})
+		errs := make(chan error, 10)
+		for i := 0; i < 10; i++ {
+			go func() {
+				_, err := extractor.Publish("songs", extractor.NewModel("songs", tokens), textextractor.Release{})
+				errs <- err
+			}()
+		}
+		for i := 0; i < 10; i++ {
+			if err := <-errs; err != nil {
+				t.Fatalf("Publish() error = %v", err)
+			}
+		}
+
+		releases, err := extractor.List("songs")
+		if err != nil || len(releases) != 10 || releases[9].Version != 10 {
+			t.Errorf("List() = %d releases, %v want 10", len(releases), err)
+		}
+	})
+
+	t.Run("unreadable registry", func(t *testing.T) {
+		registry := filepath.Join(extractor.ModelsDir, "people", "registry.json")
+		if err := os.WriteFile(registry, []byte("{"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := extractor.Load("people"); !errors.Is(err, textextractor.ErrCorruptModel) {
+			t.Errorf("Load() error = %v, want ErrCorruptModel", err)
+		}
+	})
+}
+
+func TestSignedModels(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer := textextractor.NewTextExtractor()
+	signer.ModelsDir = t.TempDir()
+	signer.SigningKey = private
+
+	tokens, _ := signer.Learn([]string{"Name: {Name}."})
+	if err := signer.Save(signer.NewModel("people", tokens), "people"); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := signer.Save(signer.NewModel("draft", tokens), "draft.json"); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	os.Remove(filepath.Join(signer.ModelsDir, "draft.json.sig"))
+
+	reader := textextractor.NewTextExtractor()
+	reader.ModelsDir = signer.ModelsDir
+	reader.VerifyKey = public
+
+	if _, err := reader.Load("people"); err != nil {
+		t.Errorf("Load() signed model error = %v", err)
+	}
+	if _, err := reader.Load("draft.json"); err != nil {
+		t.Errorf("Load() unsigned model without RequireSignature error = %v", err)
+	}
+
+	reader.RequireSignature = true
+	if _, err := reader.Load("draft.json"); !errors.Is(err, textextractor.ErrUnsignedModel) {
+		t.Errorf("Load() unsigned model error = %v, want ErrUnsignedModel", err)
+	}
+
+	path := filepath.Join(signer.ModelsDir, "people.gob")
+	data, _ := os.ReadFile(path)
+	data = bytes.Replace(data, []byte("ame: "), []byte("ome: "), 1)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reader.Load("people"); !errors.Is(err, textextractor.ErrSignatureMismatch) {
+		t.Errorf("Load() tampered model error = %v, want ErrSignatureMismatch", err)
+	}
+
+	t.Run("fs and readers", func(t *testing.T) {
+		var buf bytes.Buffer
+		model := signer.NewModel("people", tokens)
+		if err := textextractor.WriteModel(&buf, model, textextractor.FormatGob); err != nil {
+			t.Fatal(err)
+		}
+		if err := signer.Save(model, "embedded"); err != nil {
+			t.Fatal(err)
+		}
+		sig, _ := os.ReadFile(filepath.Join(signer.ModelsDir, "embedded.gob.sig"))
+		tampered := bytes.Replace(buf.Bytes(), []byte("ame: "), []byte("ome: "), 1)
+
+		fsys := fstest.MapFS{
+			"people.gob":       {Data: buf.Bytes()},
+			"people.gob.sig":   {Data: sig},
+			"tampered.gob":     {Data: tampered},
+			"tampered.gob.sig": {Data: sig},
+			"unsigned.gob":     {Data: buf.Bytes()},
+		}
+
+		if _, err := reader.LoadFS(fsys, "people"); err != nil {
+			t.Errorf("LoadFS() signed model error = %v", err)
+		}
+		if _, err := reader.LoadFS(fsys, "tampered"); !errors.Is(err, textextractor.ErrSignatureMismatch) {
+			t.Errorf("LoadFS() tampered model error = %v, want ErrSignatureMismatch", err)
+		}
+		if _, err := reader.LoadFS(fsys, "unsigned"); !errors.Is(err, textextractor.ErrUnsignedModel) {
+			t.Errorf("LoadFS() unsigned model error = %v, want ErrUnsignedModel", err)
+		}
+
+		if _, err := reader.ReadModel(bytes.NewReader(buf.Bytes()), bytes.NewReader(sig)); err != nil {
+			t.Errorf("ReadModel() signed model error = %v", err)
+		}
+		if _, err := reader.ReadModel(bytes.NewReader(tampered), bytes.NewReader(sig)); !errors.Is(err, textextractor.ErrSignatureMismatch) {
+			t.Errorf("ReadModel() tampered model error = %v, want ErrSignatureMismatch", err)
+		}
+		if _, err := reader.ReadModel(bytes.NewReader(buf.Bytes()), nil); !errors.Is(err, textextractor.ErrUnsignedModel) {
+			t.Errorf("ReadModel() unsigned model error = %v, want ErrUnsignedModel", err)
+		}
+	})
+
+	t.Run("failed signature keeps the model", func(t *testing.T) {
+		model := filepath.Join(signer.ModelsDir, "locked.gob")
+		if err := signer.Save(signer.NewModel("locked", tokens), "locked"); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		before, _ := os.ReadFile(model)
+
+		// Um diretório no lugar da assinatura faz a etapa de assinar falhar
+		os.Remove(model + ".sig")
+		if err := os.MkdirAll(filepath.Join(model+".sig", "x"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		other, _ := signer.Learn([]string{"Other: {Name}."})
+		if err := signer.Save(signer.NewModel("locked", other), "locked"); err == nil {
+			t.Fatalf("Save() with an unwritable signature, want error")
+		}
+		if after, _ := os.ReadFile(model); !bytes.Equal(after, before) {
+			t.Errorf("Save() replaced the model although signing it failed")
+		}
+	})
+
+	t.Run("failed model restores the signature", func(t *testing.T) {
+		model := filepath.Join(signer.ModelsDir, "broken.gob")
+		if err := os.MkdirAll(filepath.Join(model, "x"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(model+".sig", []byte("old\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := signer.Save(signer.NewModel("broken", tokens), "broken"); err == nil {
+			t.Fatalf("Save() over a directory, want error")
+		}
+		if sig, _ := os.ReadFile(model + ".sig"); string(sig) != "old\n" {
+			t.Errorf("signature = %q, want the old one restored", sig)
+		}
+
+		entries, _ := os.ReadDir(signer.ModelsDir)
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), ".") {
+				t.Errorf("Save() left %s behind", entry.Name())
+			}
+		}
+	})
+
+	t.Run("invalid key writes nothing", func(t *testing.T) {
+		model := filepath.Join(signer.ModelsDir, "people.gob")
+		before, _ := os.ReadFile(model)
+		sigBefore, _ := os.ReadFile(model + ".sig")
+
+		bad := *signer
+		bad.SigningKey = private[:10]
+		if err := bad.Save(bad.NewModel("other", tokens), "people"); !errors.Is(err, textextractor.ErrInvalidSigningKey) {
+			t.Fatalf("Save() error = %v, want ErrInvalidSigningKey", err)
+		}
+		after, _ := os.ReadFile(model)
+		sigAfter, _ := os.ReadFile(model + ".sig")
+		if !bytes.Equal(after, before) || !bytes.Equal(sigAfter, sigBefore) {
+			t.Errorf("Save() with an invalid key replaced the model or its signature")
+		}
+	})
+}
+
+type level int
+
+func (l *level) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "low":
+		*l = 1
+	case "high":
+		*l = 2
+	default:
+		return fmt.Errorf("unknown level %q", text)
+	}
+	return nil
+}
+
+func TestParseValueToStructTypes(t *testing.T) {
+	type Record struct {
+		Name    string        `data:"NAME"`
+		Age     int           `data:"AGE"`
+		Score   float64       `data:"SCORE"`
+		Active  bool          `data:"ACTIVE"`
+		DOB     time.Time     `data:"DOB,layout=Jan 2, 2006"`
+		Timeout time.Duration `data:"TIMEOUT"`
+		Level   level         `data:"LEVEL"`
+		Nick    *string       `data:"NICK"`
+		Codes   []int         `data:"CODE"`
+	}
+
+	extractor := textextractor.NewTextExtractor()
+	tokens, err := extractor.Learn([]string{
+		"Name: {NAME}\nAge: {AGE}\nScore: {SCORE}\nActive: {ACTIVE}\nDOB: {DOB}\nTimeout: {TIMEOUT}\nLevel: {LEVEL}\nNick: {NICK}\nCode: {CODE*}\n",
+	})
+	if err != nil {
+		t.Fatalf("Learn() error = %v", err)
+	}
+	model := extractor.NewModel("records", tokens)
+
+	input := "Name: ABBASIN\nAge: 42\nScore: 9,5\nActive: true\nDOB: Oct 4, 2011\nTimeout: 1m30s\nLevel: high\nNick: abba\nCode: 7\nCode: 9\n"
+	var record Record
+	if err := extractor.ParseValueToStruct(input, &record, model); err != nil {
+		t.Fatalf("ParseValueToStruct() error = %v", err)
+	}
+
+	nick := "abba"
+	want := Record{
+		Name:    "ABBASIN",
+		Age:     42,
+		Score:   9.5,
+		Active:  true,
+		DOB:     time.Date(2011, time.October, 4, 0, 0, 0, 0, time.UTC),
+		Timeout: 90 * time.Second,
+		Level:   2,
+		Nick:    &nick,
+		Codes:   []int{7, 9},
+	}
+	if !reflect.DeepEqual(record, want) {
+		t.Errorf("ParseValueToStruct() = %+v, want %+v", record, want)
+	}
+
+	t.Run("conversion errors", func(t *testing.T) {
+		input := "Name: ABBASIN\nAge: forty\nScore: 9,5\nActive: true\nDOB: 2011-10-04\nTimeout: 1m30s\nLevel: high\nNick: abba\nCode: 7\nCode: 9\n"
+		var record Record
+		err := extractor.ParseValueToStruct(input, &record, model)
+
+		var decodeErr *textextractor.DecodeError
+		if !errors.As(err, &decodeErr) || len(decodeErr.Fields) != 2 {
+			t.Fatalf("ParseValueToStruct() error = %v, want AGE and DOB to fail", err)
+		}
+		if decodeErr.Fields[0].Field != "Age" || decodeErr.Fields[1].Field != "DOB" {
+			t.Errorf("DecodeError fields = %+v", decodeErr.Fields)
+		}
+		if record.Name != "ABBASIN" || record.Timeout != 90*time.Second {
+			t.Errorf("ParseValueToStruct() = %+v, want the other fields set", record)
+		}
+	})
+
+	t.Run("unsupported slices", func(t *testing.T) {
+		var record struct {
+			Name  string     `data:"NAME"`
+			Codes *[]string  `data:"CODE"`
+			Table [][]string `data:"NICK"`
+		}
+		err := extractor.ParseValueToStruct(input, &record, model)
+
+		var decodeErr *textextractor.DecodeError
+		if !errors.As(err, &decodeErr) || len(decodeErr.Fields) != 2 {
+			t.Fatalf("ParseValueToStruct() error = %v, want Codes and Table to fail", err)
+		}
+		for i, field := range []string{"Codes", "Table"} {
+			if got := decodeErr.Fields[i]; got.Field != field || !strings.Contains(got.Err.Error(), "unsupported type") {
+				t.Errorf("DecodeError field %d = %+v, want %s unsupported", i, got, field)
+			}
+		}
+		if record.Name != "ABBASIN" {
+			t.Errorf("ParseValueToStruct() = %+v, want Name set", record)
+		}
+	})
+}
+
+func TestDataTagOptions(t *testing.T) {
+	type Invoice struct {
+		Number string  `data:"NUMBER,required"`
+		Total  float64 `data:"TOTAL,required,default=0,regex=^[0-9.,]+$"`
+		Due    string  `data:"DUE,required"`
+		Note   string  `data:"NOTE,minconf=5"`
+		Code   string  `data:"CODE,regex=^[A-Z]{2,3}-[0-9]+$"`
+	}
+
+	extractor := textextractor.NewTextExtractor()
+	extractor.Weights = textextractor.PrecisionWeights{WordLengthWeight: 1, TokenLengthWeight: 1, CharacterCountWeight: 1}
+	tokens, err := extractor.Learn([]string{"Number: {NUMBER}\nTotal: {TOTAL}\nDue: {DUE}\nNote: {NOTE}\nCode: {CODE}\n"})
+	if err != nil {
+		t.Fatalf("Learn() error = %v", err)
+	}
+	model := extractor.NewModel("invoices", tokens)
+
+	t.Run("valid", func(t *testing.T) {
+		var invoice Invoice
+		input := "Number: 123\nTotal: 10,50\nDue: tomorrow\nNote: paid\nCode: AB-7\n"
+		err := extractor.ParseValueToStruct(input, &invoice, extractor.NewModel("invoices", tokens[:3]))
+		if err != nil || invoice.Total != 10.5 || invoice.Due != "tomorrow" {
+			t.Errorf("ParseValueToStruct() = %+v, %v", invoice, err)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		invoice := Invoice{Total: 99}
+		input := "Number: \nTotal: ten\nDue: \nNote: paid\nCode: AB-7\n"
+		err := extractor.ParseValueToStruct(input, &invoice, model)
+
+		var validation *textextractor.ValidationError
+		if !errors.As(err, &validation) {
+			t.Fatalf("ParseValueToStruct() error = %v, want a ValidationError", err)
+		}
+
+		missing := validation.Missing()
+		if len(missing) != 2 || missing[0].Field != "Number" || missing[1].Field != "Due" {
+			t.Errorf("Missing() = %+v, want Number and Due", missing)
+		}
+		if low := validation.LowConfidence(); len(low) != 1 || low[0].Field != "Note" {
+			t.Errorf("LowConfidence() = %+v, want Note", low)
+		}
+		if mismatched := validation.Mismatched(); len(mismatched) != 1 || mismatched[0].Value != "ten" {
+			t.Errorf("Mismatched() = %+v, want Total", mismatched)
+		}
+		if !errors.Is(err, textextractor.ErrRequired) {
+			t.Errorf("ParseValueToStruct() error = %v, want ErrRequired", err)
+		}
+
+		if invoice.Total != 0 || invoice.Note != "" || invoice.Code != "AB-7" {
+			t.Errorf("ParseValueToStruct() = %+v, want the default Total and no Note", invoice)
+		}
+	})
+
+	// Com pesos 1, a precisão é (2*len(valor) + len("NOTE")) / 3
+	t.Run("minconf", func(t *testing.T) {
+		for _, tt := range []struct {
+			note string
+			low  bool
+		}{
+			{"paid", true},          // (8 + 4) / 3 = 4
+			{"paid in full", false}, // (24 + 4) / 3 = 9.33
+		} {
+			var invoice Invoice
+			input := "Number: 1\nTotal: 1\nDue: now\nNote: " + tt.note + "\nCode: AB-7\n"
+			err := extractor.ParseValueToStruct(input, &invoice, model)
+
+			var validation *textextractor.ValidationError
+			low := errors.As(err, &validation) && len(validation.LowConfidence()) == 1
+			if low != tt.low || (!tt.low && invoice.Note != tt.note) {
+				t.Errorf("ParseValueToStruct(%q) = %+v, %v want low confidence %v", tt.note, invoice, err, tt.low)
+			}
+		}
+	})
+
+	t.Run("minconf without weights", func(t *testing.T) {
+		unweighted := textextractor.NewTextExtractor()
+		var invoice Invoice
+		input := "Number: 1\nTotal: 1\nDue: now\nNote: paid in full\nCode: AB-7\n"
+		err := unweighted.ParseValueToStruct(input, &invoice, unweighted.NewModel("invoices", tokens))
+
+		var decodeErr *textextractor.DecodeError
+		if !errors.As(err, &decodeErr) || len(decodeErr.Fields) != 1 || decodeErr.Fields[0].Field != "Note" {
+			t.Errorf("ParseValueToStruct() error = %v, want a DecodeError for Note", err)
+		}
+	})
+}
+
+func TestNestedStructs(t *testing.T) {
+	type Address struct {
+		City string `data:"CITY"`
+	}
+	type Item struct {
+		Product string  `data:"PRODUCT"`
+		Price   float64 `data:"PRICE,required"`
+	}
+	type Invoice struct {
+		Number  string   `data:"NUMBER"`
+		Address *Address `data:",segment=(?m)^Address:"`
+		Items   []Item   `data:"ITEMS,segment=(?m)^Item:"`
+	}
+
+	extractor := textextractor.NewTextExtractor()
+	tokens, err := extractor.Learn([]string{
+		"Invoice {NUMBER}\n",
+		"Address: {CITY}\n",
+		"Item: {PRODUCT}\nPrice: {PRICE}\n",
+	})
+	if err != nil {
+		t.Fatalf("Learn() error = %v", err)
+	}
+	model := extractor.NewModel("invoices", tokens)
+
+	input := "Invoice 42\nAddress: Kabul\nItem: tea\nPrice: 2,50\nItem: rice\nPrice: 10\nItem: salt\nPrice: n/a\n"
+	var invoice Invoice
+	err = extractor.ParseValueToStruct(input, &invoice, model)
+
+	want := Invoice{
+		Number:  "42",
+		Address: &Address{City: "Kabul"},
+		Items:   []Item{{Product: "tea", Price: 2.5}, {Product: "rice", Price: 10}, {Product: "salt"}},
+	}
+	if !reflect.DeepEqual(invoice, want) {
+		t.Errorf("ParseValueToStruct() = %+v, want %+v", invoice, want)
+	}
+
+	var decodeErr *textextractor.DecodeError
+	if !errors.As(err, &decodeErr) || len(decodeErr.Fields) != 1 || decodeErr.Fields[0].Field != "Items[2].Price" {
+		t.Errorf("ParseValueToStruct() error = %v, want Items[2].Price to fail", err)
+	}
+}
+
+func TestNestedStructsUntagged(t *testing.T) {
+	type Address struct {
+		City string `data:"CITY"`
+	}
+	type Node struct {
+		Name   string   `data:"NAME"`
+		Parent *Node    `data:",segment=(?m)^Parent:"`
+		Home   *Address // sem tag, não é preenchido
+		Work   *Address `data:",segment=(?m)^Work:"`
+	}
+
+	extractor := textextractor.NewTextExtractor()
+	tokens, err := extractor.Learn([]string{"Name: {NAME}\n", "City: {CITY}\n"})
+	if err != nil {
+		t.Fatalf("Learn() error = %v", err)
+	}
+	model := extractor.NewModel("nodes", tokens)
+
+	var node Node
+	if err := extractor.ParseValueToStruct("Name: root\nCity: Kabul\nParent: x\nWork: none\n", &node, model); err != nil {
+		t.Fatalf("ParseValueToStruct() error = %v", err)
+	}
+
+	want := Node{Name: "root"}
+	if !reflect.DeepEqual(node, want) {
+		t.Errorf("ParseValueToStruct() = %+v, want %+v", node, want)
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	type Person struct {
+		Name string `data:"NAME"`
+		Age  int    `data:"AGE"`
+	}
+
+	extractor := textextractor.NewTextExtractor()
+	tokens, err := extractor.Learn([]string{"Name: {NAME}\nAge: {AGE}\n"})
+	if err != nil {
+		t.Fatalf("Learn() error = %v", err)
+	}
+	model := extractor.NewModel("people", tokens)
+	input := "Name: ABBASIN\nAge: 42\n"
+
+	var person Person
+	if err := textextractor.Unmarshal(model, input, &person); err != nil || person != (Person{Name: "ABBASIN", Age: 42}) {
+		t.Errorf("Unmarshal() = %+v, %v", person, err)
+	}
+
+	person = Person{}
+	if err := textextractor.UnmarshalReader(model, strings.NewReader(input), &person); err != nil || person.Age != 42 {
+		t.Errorf("UnmarshalReader() = %+v, %v", person, err)
+	}
+
+	var nilPerson *Person
+	var number int
+	for _, v := range []interface{}{nil, person, nilPerson, &number} {
+		var invalid *textextractor.InvalidUnmarshalError
+		if err := textextractor.Unmarshal(model, input, v); !errors.As(err, &invalid) {
+			t.Errorf("Unmarshal(%T) error = %v, want InvalidUnmarshalError", v, err)
+		}
+	}
+
+	if err := textextractor.Unmarshal(nil, input, &person); !errors.Is(err, textextractor.ErrNilModel) {
+		t.Errorf("Unmarshal(nil model) error = %v, want ErrNilModel", err)
+	}
+}
+
+func TestExtractAll(t *testing.T) {
+	extractor := textextractor.NewTextExtractor()
+	extractor.Weights = textextractor.PrecisionWeights{WordLengthWeight: 1, TokenLengthWeight: 1, CharacterCountWeight: 1}
+
+	// Duas âncoras concorrentes para NAME: vence o valor com maior precisão
+	nick, err := extractor.Learn([]string{"Nick: {NAME}\n"})
+	if err != nil {
+		t.Fatalf("Learn() error = %v", err)
+	}
+	tokens, err := extractor.Learn([]string{"Name: {NAME}\nPhone: {PHONE*}\nAge: {AGE:int}\n"})
+	if err != nil {
+		t.Fatalf("Learn() error = %v", err)
+	}
+	model := extractor.NewModel("people", append(nick, tokens...))
+
+	result, err := textextractor.ExtractAll(model, "Nick: AB\nName: ABBASIN\nPhone: 555-0101\nPhone: 555-0102\nAge: 42\n")
+	if err != nil {
+		t.Fatalf("ExtractAll() error = %v", err)
+	}
+
+	var order []string
+	for _, extracted := range result {
+		order = append(order, extracted.Token)
+	}
+	if !reflect.DeepEqual(order, []string{"AGE", "NAME", "PHONE"}) {
+		t.Errorf("ExtractAll() order = %v, want tokens sorted", order)
+	}
+
+	want := map[string]interface{}{"AGE": "42", "NAME": "ABBASIN", "PHONE": []string{"555-0101", "555-0102"}}
+	if got := result.ToMap(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ToMap() = %v, want %v", got, want)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("MarshalJSON() error = %v", err)
+	}
+	wantJSON := `{"AGE":{"value":"42","precision":2.3333333333333335},"NAME":{"value":"ABBASIN","precision":6},"PHONE":{"value":["555-0101","555-0102"],"precision":7}}`
+	if string(data) != wantJSON {
+		t.Errorf("MarshalJSON() = %s, want %s", data, wantJSON)
+	}
+
+	if got, ok := result.Get("NAME"); !ok || got.Value != "ABBASIN" {
+		t.Errorf("Get(NAME) = %+v, %v", got, ok)
+	}
+
+	// A âncora aprendida primeiro não vence só pela ordem
+	result, err = textextractor.ExtractAll(model, "Nick: ABBASIN\nName: AB\n")
+	if got, ok := result.Get("NAME"); err != nil || !ok || got.Value != "ABBASIN" || got.Precision != 6 {
+		t.Errorf("ExtractAll() NAME = %+v, %v, want ABBASIN from Nick", got, err)
+	}
+	if _, err := textextractor.ExtractAll(nil, ""); !errors.Is(err, textextractor.ErrNilModel) {
+		t.Errorf("ExtractAll(nil) error = %v, want ErrNilModel", err)
+	}
+}
+
+func TestEqualPrecisionPrefersLongerValue(t *testing.T) {
+	type Person struct {
+		Title string `data:"TITLE"`
+	}
+
+	extractor := textextractor.NewTextExtractor()
+	// O primeiro token para no primeiro ponto, que também aparece dentro do valor
+	model := extractor.NewModel("titles", []textextractor.TokenTrain{
+		{Name: "TITLE", WordBefore: "Title: ", WordAfter: "."},
+		{Name: "TITLE", WordBefore: "Title: ", WordAfter: "\n"},
+	})
+
+	var person Person
+	if err := extractor.ParseValueToStruct("Title: Dr. John\n", &person, model); err != nil {
+		t.Fatalf("ParseValueToStruct() error = %v", err)
+	}
+	if person.Title != "Dr. John" {
+		t.Errorf("ParseValueToStruct() = %q, want the longer of two equally precise values", person.Title)
+	}
+}
@@ -0,0 +1,104 @@
+package textextractor
+
+import (
+	"regexp"
+	"strings"
+)
+
+// placeholderTypes maps a placeholder type to the pattern its value must match.
+// Types whose pattern ends in "+" can be made lazy when a delimiter follows the value.
+var placeholderTypes = map[string]string{
+	"date":  `\d{1,2}[/.-]\d{1,2}[/.-]\d{2,4}|\d{4}-\d{1,2}-\d{1,2}`,
+	"int":   `[-+]?\d+`,
+	"float": `[-+]?\d+(?:[.,]\d+)?`,
+	"money": `[-+]?(?:[A-Z]{3} ?|R\$ ?|[$€£¥] ?)?\d+(?:[., ]\d{3})*(?:[.,]\d{1,2})?(?: ?[A-Z]{3}| ?[$€£¥])?`,
+	"email": `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+	"phone": `\+?\d[\d ().-]{5,}\d`,
+	"word":  `\S+`,
+	"line":  `[^\n]+`,
+	"text":  `(?s:.)+`,
+}
+
+// typeValidators match a whole value against its placeholder type, compiled once.
+var typeValidators = func() map[string]*regexp.Regexp {
+	validators := make(map[string]*regexp.Regexp, len(placeholderTypes))
+	for typ, pattern := range placeholderTypes {
+		validators[typ] = regexp.MustCompile(`^(?:` + pattern + `)$`)
+	}
+	return validators
+}()
+
+// typeFinders find every value of a type in a list of them, compiled once.
+var typeFinders = func() map[string]*regexp.Regexp {
+	finders := make(map[string]*regexp.Regexp, len(placeholderTypes))
+	for typ, pattern := range placeholderTypes {
+		finders[typ] = regexp.MustCompile(pattern)
+	}
+	return finders
+}()
+
+// lazyTypes are the types that may span a delimiter and must stop at the first one.
+var lazyTypes = map[string]bool{
+	"":     true,
+	"line": true,
+	"text": true,
+}
+
+// typePattern returns the value pattern for a placeholder type.
+// An empty type keeps the historical behaviour of matching anything on the line.
+func typePattern(typ string, lazy bool) (string, bool) {
+	pattern := `.+`
+	if typ != "" {
+		p, ok := placeholderTypes[typ]
+		if !ok {
+			return "", false
+		}
+		pattern = p
+	}
+
+	if lazy && lazyTypes[typ] {
+		pattern += `?`
+	}
+
+	return pattern, true
+}
+
+// listPattern returns the value pattern for a placeholder. A repeated typed placeholder
+// also matches a list of values separated by spaces, commas or semicolons.
+func listPattern(typ string, repeated, lazy bool) (string, bool) {
+	pattern, ok := typePattern(typ, lazy)
+	if ok && repeated && typ != "" {
+		pattern = `(?:` + pattern + `)(?:[\s,;]+(?:` + pattern + `))*`
+	}
+
+	return pattern, ok
+}
+
+// splitList returns the values of a list matched by listPattern.
+func splitList(typ string, repeated bool, value string) []string {
+	if !repeated || typ == "" {
+		return []string{value}
+	}
+
+	return typeFinders[typ].FindAllString(value, -1)
+}
+
+// splitTokenType splits "DOB:date" into its name and type.
+func splitTokenType(token string) (string, string) {
+	name, typ, _ := strings.Cut(token, ":")
+	return strings.TrimSpace(name), strings.TrimSpace(typ)
+}
+
+// validType reports whether the whole value matches its placeholder type.
+func validType(typ, value string) bool {
+	if typ == "" {
+		return true
+	}
+
+	validator, ok := typeValidators[typ]
+	if !ok {
+		return false
+	}
+
+	return validator.MatchString(value)
+}
@@ -0,0 +1,78 @@
+package textextractor
+
+import (
+	"errors"
+	"io"
+	"reflect"
+)
+
+// ErrNilModel is returned when extracting with a nil model.
+var ErrNilModel = errors.New("textextractor: nil model")
+
+// InvalidUnmarshalError describes an invalid argument passed to Unmarshal: v must be a
+// non-nil pointer to a struct.
+type InvalidUnmarshalError struct {
+	Type reflect.Type
+}
+
+func (e *InvalidUnmarshalError) Error() string {
+	switch {
+	case e.Type == nil:
+		return "textextractor: Unmarshal(nil)"
+	case e.Type.Kind() != reflect.Pointer:
+		return "textextractor: Unmarshal(non-pointer " + e.Type.String() + ")"
+	case e.Type.Elem().Kind() != reflect.Struct:
+		return "textextractor: Unmarshal(non-struct " + e.Type.String() + ")"
+	}
+
+	return "textextractor: Unmarshal(nil " + e.Type.String() + ")"
+}
+
+// Unmarshal extracts the values of the model's tokens from input and stores them in the
+// struct pointed to by v, like ParseValueToStruct. The model's Weights score the values.
+func Unmarshal(model *Model, input string, v interface{}) error {
+	return unmarshal(model, input, v, PrecisionWeights{})
+}
+
+// UnmarshalReader reads the whole input from r and unmarshals it like Unmarshal.
+func UnmarshalReader(model *Model, r io.Reader, v interface{}) error {
+	if err := checkUnmarshal(model, v); err != nil {
+		return err
+	}
+
+	input, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	return unmarshal(model, string(input), v, PrecisionWeights{})
+}
+
+// unmarshal fills v, scoring values with weights when the model has none.
+func unmarshal(model *Model, input string, v interface{}, weights PrecisionWeights) error {
+	if err := checkUnmarshal(model, v); err != nil {
+		return err
+	}
+
+	d := &structDecoder{model: model, weights: model.weights(weights)}
+	d.decodeStruct(reflect.ValueOf(v).Elem(), input, "")
+
+	return d.err()
+}
+
+// checkUnmarshal validates the arguments of Unmarshal.
+func checkUnmarshal(model *Model, v interface{}) error {
+	if model == nil {
+		return ErrNilModel
+	}
+	if err := model.check(); err != nil {
+		return err
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return &InvalidUnmarshalError{Type: reflect.TypeOf(v)}
+	}
+
+	return nil
+}